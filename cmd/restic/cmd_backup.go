@@ -10,7 +10,6 @@ import (
 	"os"
 	"path"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -58,6 +57,10 @@ given as the arguments.
 
 		var t tomb.Tomb
 		term := termstatus.New(globalOptions.stdout, globalOptions.stderr, globalOptions.Quiet)
+		// the interval is also used for the status updates of the backup
+		if d, ok := restic.ProgressInterval(); ok && !globalOptions.Quiet {
+			term.SetStatusInterval(d)
+		}
 		t.Go(func() error { term.Run(t.Context(globalOptions.ctx)); return nil })
 
 		err := runBackup(backupOptions, globalOptions, term, args)
@@ -79,6 +82,7 @@ type BackupOptions struct {
 	ExcludeOtherFS      bool
 	ExcludeIfPresent    []string
 	ExcludeCaches       bool
+	IgnoreFiles         []string
 	Stdin               bool
 	StdinFilename       string
 	Tags                []string
@@ -87,6 +91,7 @@ type BackupOptions struct {
 	TimeStamp           string
 	WithAtime           bool
 	IgnoreInode         bool
+	FollowSymlinks      bool
 }
 
 var backupOptions BackupOptions
@@ -103,6 +108,7 @@ func init() {
 	f.BoolVarP(&backupOptions.ExcludeOtherFS, "one-file-system", "x", false, "exclude other file systems")
 	f.StringArrayVar(&backupOptions.ExcludeIfPresent, "exclude-if-present", nil, "takes filename[:header], exclude contents of directories containing filename (except filename itself) if header of that file is as provided (can be specified multiple times)")
 	f.BoolVar(&backupOptions.ExcludeCaches, "exclude-caches", false, `excludes cache directories that are marked with a CACHEDIR.TAG file. See http://bford.info/cachedir/spec.html for the Cache Directory Tagging Standard`)
+	f.StringArrayVar(&backupOptions.IgnoreFiles, "use-ignore-file", nil, "read exclude patterns from files with this `name` in the backed up directories, they apply to the directory the file is in (can be specified multiple times)")
 	f.BoolVar(&backupOptions.Stdin, "stdin", false, "read backup from stdin")
 	f.StringVar(&backupOptions.StdinFilename, "stdin-filename", "stdin", "file name to use when reading from stdin")
 	f.StringArrayVar(&backupOptions.Tags, "tag", nil, "add a `tag` for the new snapshot (can be specified multiple times)")
@@ -115,6 +121,7 @@ func init() {
 	f.StringVar(&backupOptions.TimeStamp, "time", "", "time of the backup (ex. '2012-11-01 22:08:41') (default: now)")
 	f.BoolVar(&backupOptions.WithAtime, "with-atime", false, "store the atime for all files and directories")
 	f.BoolVar(&backupOptions.IgnoreInode, "ignore-inode", false, "ignore inode number changes when checking for modified files")
+	f.BoolVar(&backupOptions.FollowSymlinks, "follow-symlinks", false, "back up the files or directories symlinks given as targets point to, instead of the symlinks")
 }
 
 // filterExisting returns a slice of all existing items, or an error if no
@@ -250,6 +257,15 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, t
 		fs = append(fs, f)
 	}
 
+	for _, name := range opts.IgnoreFiles {
+		f, err := rejectByIgnoreFile(name, targets)
+		if err != nil {
+			return nil, errors.Fatalf("--use-ignore-file: %v", err)
+		}
+
+		fs = append(fs, f)
+	}
+
 	return fs, nil
 }
 
@@ -258,7 +274,7 @@ func collectRejectByNameFuncs(opts BackupOptions, repo *repository.Repository, t
 func collectRejectFuncs(opts BackupOptions, repo *repository.Repository, targets []string) (fs []RejectFunc, err error) {
 	// allowed devices
 	if opts.ExcludeOtherFS && !opts.Stdin {
-		f, err := rejectByDevice(targets)
+		f, err := rejectByDevice(targets, opts.FollowSymlinks)
 		if err != nil {
 			return nil, err
 		}
@@ -451,14 +467,9 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	}()
 	gopts.stdout, gopts.stderr = p.Stdout(), p.Stderr()
 
-	if s, ok := os.LookupEnv("RESTIC_PROGRESS_FPS"); ok {
-		fps, err := strconv.Atoi(s)
-		if err == nil && fps >= 1 {
-			if fps > 60 {
-				fps = 60
-			}
-			p.SetMinUpdatePause(time.Second / time.Duration(fps))
-		}
+	// update the status as often as the terminal prints it
+	if d := term.StatusInterval(); d > 0 {
+		p.SetMinUpdatePause(d)
 	}
 
 	t.Go(func() error { return p.Run(t.Context(gopts.ctx)) })
@@ -554,6 +565,7 @@ func runBackup(opts BackupOptions, gopts GlobalOptions, term *termstatus.Termina
 	arch.StartFile = p.StartFile
 	arch.CompleteBlob = p.CompleteBlob
 	arch.IgnoreInode = opts.IgnoreInode
+	arch.FollowTargetSymlinks = opts.FollowSymlinks
 
 	if parentSnapshotID == nil {
 		parentSnapshotID = &restic.ID{}
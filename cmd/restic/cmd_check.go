@@ -1,9 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +16,7 @@ import (
 	"github.com/restic/restic/internal/checker"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 )
 
@@ -25,6 +29,20 @@ finds. It can also be used to read all data and therefore simulate a restore.
 
 By default, the "check" command will always load all data directly from the
 repository and not use a local cache.
+
+Salvaging Damaged Packs
+=======================
+
+When data is read with --read-data or --read-data-subset, the --salvage option
+can be used to recover as much data as possible from pack files which are
+truncated or contain blobs that cannot be decrypted. All blobs of a damaged
+pack which are still intact are saved into new pack files and a new index is
+written. The damaged pack files are then moved into the local directory given
+with --quarantine-dir and removed from the repository. Packs which could not
+be read completely, for example because of a network error, are not salvaged.
+
+Blobs which cannot be recovered are listed at the end. Running "backup --force"
+for the affected files stores the missing data in the repository again.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -39,8 +57,11 @@ repository and not use a local cache.
 type CheckOptions struct {
 	ReadData       bool
 	ReadDataSubset string
+	ReadDataMemory uint
 	CheckUnused    bool
 	WithCache      bool
+	Salvage        bool
+	QuarantineDir  string
 }
 
 var checkOptions CheckOptions
@@ -51,11 +72,17 @@ func init() {
 	f := cmdCheck.Flags()
 	f.BoolVar(&checkOptions.ReadData, "read-data", false, "read all data blobs")
 	f.StringVar(&checkOptions.ReadDataSubset, "read-data-subset", "", "read subset n of m data packs (format: `n/m`)")
+	f.UintVar(&checkOptions.ReadDataMemory, "read-data-memory", 64, "limit the memory used to buffer blobs while reading data to `n` MiB, larger blobs are not checked")
 	f.BoolVar(&checkOptions.CheckUnused, "check-unused", false, "find unused blobs")
 	f.BoolVar(&checkOptions.WithCache, "with-cache", false, "use the cache")
+	f.BoolVar(&checkOptions.Salvage, "salvage", false, "save the intact blobs of damaged packs into new packs and remove the damaged packs")
+	f.StringVar(&checkOptions.QuarantineDir, "quarantine-dir", "", "move damaged packs into the local `directory` when using --salvage")
 }
 
 func checkFlags(opts CheckOptions) error {
+	if opts.ReadDataMemory < 1 || opts.ReadDataMemory > maxReadDataMemory {
+		return errors.Fatalf("check flag --read-data-memory must be between 1 and %d MiB", maxReadDataMemory)
+	}
 	if opts.ReadData && opts.ReadDataSubset != "" {
 		return errors.Fatalf("check flags --read-data and --read-data-subset cannot be used together")
 	}
@@ -71,6 +98,16 @@ func checkFlags(opts CheckOptions) error {
 			return errors.Fatalf("check flag --read-data-subset=n/t t must be at most %d", totalBucketsMax)
 		}
 	}
+	if opts.Salvage {
+		if !opts.ReadData && opts.ReadDataSubset == "" {
+			return errors.Fatal("check flag --salvage requires --read-data or --read-data-subset")
+		}
+		if opts.QuarantineDir == "" {
+			return errors.Fatal("check flag --salvage requires --quarantine-dir")
+		}
+	} else if opts.QuarantineDir != "" {
+		return errors.Fatal("check flag --quarantine-dir can only be used together with --salvage")
+	}
 
 	return nil
 }
@@ -78,6 +115,10 @@ func checkFlags(opts CheckOptions) error {
 // See doReadData in runCheck below for why this is 256.
 const totalBucketsMax = 256
 
+// maxReadDataMemory is the largest value in MiB accepted for
+// --read-data-memory, larger values would overflow when converted to bytes.
+const maxReadDataMemory = 1024 * 1024
+
 // stringToIntSlice converts string to []uint, using '/' as element separator
 func stringToIntSlice(param string) (split []uint, err error) {
 	if param == "" {
@@ -178,14 +219,29 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		return nil
 	})
 
+	if opts.Salvage && gopts.NoLock {
+		return errors.Fatal("check flag --salvage cannot be used together with --no-lock")
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if opts.Salvage && repo.ReadOnly() {
+		return errors.Fatal("check flag --salvage cannot be used with a restore-only key")
+	}
+
 	if !gopts.NoLock {
-		Verbosef("create exclusive lock for repository\n")
-		lock, err := lockRepoExclusive(repo)
+		// restore-only keys cannot create exclusive locks, a shared lock
+		// still keeps prune from running concurrently
+		lockFn, lockType := lockRepoExclusive, "exclusive"
+		if repo.ReadOnly() {
+			lockFn, lockType = lockRepo, "shared"
+		}
+
+		Verbosef("create %v lock for repository\n", lockType)
+		lock, err := lockFn(repo)
 		defer unlockRepo(lock)
 		if err != nil {
 			return err
@@ -193,6 +249,7 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 	}
 
 	chkr := checker.New(repo)
+	chkr.SetReadDataMemory(int64(opts.ReadDataMemory) << 20)
 
 	Verbosef("load indexes\n")
 	hints, errs := chkr.LoadIndex(gopts.ctx)
@@ -296,6 +353,13 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 		doReadData(dataSubset[0], dataSubset[1])
 	}
 
+	if damaged := chkr.DamagedPacks(); opts.Salvage && len(damaged) > 0 {
+		err = salvagePacks(gopts, repo, damaged, opts.QuarantineDir)
+		if err != nil {
+			return err
+		}
+	}
+
 	if errorsFound {
 		return errors.Fatal("repository contains errors")
 	}
@@ -304,3 +368,98 @@ func runCheck(opts CheckOptions, gopts GlobalOptions, args []string) error {
 
 	return nil
 }
+
+// salvagePacks copies the damaged packs into the quarantine directory, saves
+// all intact blobs into new packs and afterwards removes the damaged packs
+// from the repository.
+func salvagePacks(gopts GlobalOptions, repo *repository.Repository, packs restic.IDSet, quarantineDir string) error {
+	ctx := gopts.ctx
+
+	Verbosef("salvage %d damaged packs\n", len(packs))
+
+	err := fs.MkdirAll(quarantineDir, 0700)
+	if err != nil {
+		return errors.Fatalf("unable to create quarantine directory: %v", err)
+	}
+
+	for id := range packs {
+		err = quarantinePack(ctx, repo, id, quarantineDir)
+		if err != nil {
+			return errors.Fatalf("unable to quarantine pack %v: %v", id.Str(), err)
+		}
+	}
+
+	stats, err := repository.Salvage(ctx, repo, packs)
+	if err != nil {
+		return err
+	}
+
+	for id := range packs {
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		err = repo.Backend().Remove(ctx, h)
+		if err != nil && !repo.Backend().IsNotExist(err) {
+			Warnf("error removing damaged pack %v: %v\n", id.Str(), err)
+		}
+	}
+
+	Printf("salvaged %d of %d blobs from %d damaged packs, %d blobs are stored in other packs\n",
+		stats.Salvaged, stats.Blobs, len(packs), stats.Duplicate)
+	Printf("damaged packs were moved to %v\n", quarantineDir)
+
+	if len(stats.Lost) > 0 {
+		Printf("%d blobs could not be salvaged:\n", len(stats.Lost))
+		for h := range stats.Lost {
+			Printf("  %v\n", h)
+		}
+	}
+
+	return nil
+}
+
+// quarantinePack saves the complete content of the pack id into a file in dir.
+// An error is returned if the pack cannot be read completely, the file is then
+// removed again.
+func quarantinePack(ctx context.Context, repo restic.Repository, id restic.ID, dir string) error {
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+
+	fi, err := repo.Backend().Stat(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	filename := filepath.Join(dir, id.String())
+	f, err := fs.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	var size int64
+	err = repo.Backend().Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		// start over if the backend retries the request
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+
+		var err error
+		size, err = io.Copy(f, rd)
+		return err
+	})
+	if err == nil && size != fi.Size {
+		err = errors.Errorf("read %d bytes, expected %d", size, fi.Size)
+	}
+
+	cerr := f.Close()
+	if err == nil {
+		err = cerr
+	}
+
+	if err != nil {
+		_ = fs.Remove(filename)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestCheckFlagsReadDataMemory(t *testing.T) {
+	var tests = []struct {
+		mem   uint
+		valid bool
+	}{
+		{0, false},
+		{1, true},
+		{64, true},
+		{maxReadDataMemory, true},
+		{maxReadDataMemory + 1, false},
+		{^uint(0), false},
+	}
+
+	for _, test := range tests {
+		err := checkFlags(CheckOptions{ReadData: true, ReadDataMemory: test.mem})
+		if test.valid && err != nil {
+			t.Errorf("--read-data-memory %d: unexpected error %v", test.mem, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("--read-data-memory %d: expected error, got none", test.mem)
+		}
+	}
+}
+
+// failLoadBackend returns an error for every pack which is loaded.
+type failLoadBackend struct {
+	restic.Backend
+	fail bool
+}
+
+func (be *failLoadBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if be.fail && h.Type == restic.DataFile {
+		return errors.New("load failed")
+	}
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestQuarantinePack(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	failBe := &failLoadBackend{Backend: be}
+	repo, cleanup := repository.TestRepositoryWithBackend(t, failBe)
+	defer cleanup()
+
+	_, err := repo.SaveBlob(context.TODO(), restic.DataBlob, rtest.Random(23, 1000), restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	var packID restic.ID
+	rtest.OK(t, repo.List(context.TODO(), restic.DataFile, func(id restic.ID, size int64) error {
+		packID = id
+		return nil
+	}))
+
+	dir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	// a pack which cannot be loaded is not quarantined
+	failBe.fail = true
+	err = quarantinePack(context.TODO(), repo, packID, dir)
+	rtest.Assert(t, err != nil, "quarantining an unreadable pack did not fail")
+	_, err = os.Stat(filepath.Join(dir, packID.String()))
+	rtest.Assert(t, os.IsNotExist(err), "file for unreadable pack was not removed, error %v", err)
+
+	failBe.fail = false
+	rtest.OK(t, quarantinePack(context.TODO(), repo, packID, dir))
+	buf, err := ioutil.ReadFile(filepath.Join(dir, packID.String()))
+	rtest.OK(t, err)
+	rtest.Equals(t, packID, restic.Hash(buf))
+}
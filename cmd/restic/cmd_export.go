@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/restic/restic/internal/bundle"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdExport = &cobra.Command{
+	Use:   "export [flags] snapshotID file",
+	Short: "Export a snapshot into a bundle file",
+	Long: `
+The "export" command writes a snapshot together with all data it references
+into a single file, a so-called bundle. The bundle is encrypted with its own
+password, which is asked for when the bundle is created. It can be imported
+into another repository with the "import" command, e.g. to transfer a backup
+to a system without network access.
+
+If the file is "-", the bundle is written to stdout. The special snapshot
+"latest" can be used to export the latest snapshot in the repository.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runExport(exportOptions, globalOptions, args)
+	},
+}
+
+// ExportOptions collects all options for the export command.
+type ExportOptions struct {
+	Host               string
+	Paths              []string
+	Tags               restic.TagLists
+	BundlePasswordFile string
+}
+
+var exportOptions ExportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdExport)
+
+	flags := cmdExport.Flags()
+	flags.StringVarP(&exportOptions.Host, "host", "H", "", `only consider snapshots for this host when the snapshot ID is "latest"`)
+	flags.Var(&exportOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
+	flags.StringArrayVar(&exportOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
+	flags.StringVar(&exportOptions.BundlePasswordFile, "bundle-password-file", "", "read the password for the bundle from a `file`")
+}
+
+// testBundlePassword is used to set the bundle password during integration
+// testing.
+var testBundlePassword string
+
+func getBundlePassword(gopts GlobalOptions, passwordFile string, twice bool) (string, error) {
+	if testBundlePassword != "" {
+		return testBundlePassword, nil
+	}
+
+	if passwordFile != "" {
+		return loadPasswordFromFile(passwordFile)
+	}
+
+	// the repository password must not be used for the bundle
+	opts := gopts
+	opts.password = ""
+
+	if twice {
+		return ReadPasswordTwice(opts,
+			"enter password for bundle: ",
+			"enter password again: ")
+	}
+
+	return ReadPassword(opts, "enter password for bundle: ")
+}
+
+func runExport(opts ExportOptions, gopts GlobalOptions, args []string) (err error) {
+	ctx := gopts.ctx
+
+	if len(args) != 2 {
+		return errors.Fatal("please specify a snapshot ID and a file to write the bundle to")
+	}
+
+	snapshotIDString, filename := args[0], args[1]
+
+	var wr io.Writer = globalOptions.stdout
+	if filename == "-" {
+		if stdoutIsTerminal() {
+			return errors.Fatal("stdout is the terminal, please redirect output")
+		}
+
+		// the bundle is written to stdout, so all messages go to stderr
+		stdout := globalOptions.stdout
+		globalOptions.stdout = globalOptions.stderr
+		defer func() {
+			globalOptions.stdout = stdout
+		}()
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	if !gopts.NoLock {
+		lock, err := lockRepo(repo)
+		defer unlockRepo(lock)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	var id restic.ID
+	if snapshotIDString == "latest" {
+		id, err = restic.FindLatestSnapshot(ctx, repo, opts.Paths, opts.Tags, opts.Host)
+		if err != nil {
+			return errors.Fatalf("latest snapshot for criteria not found: %v Paths:%v Host:%v", err, opts.Paths, opts.Host)
+		}
+	} else {
+		id, err = restic.FindSnapshot(repo, snapshotIDString)
+		if err != nil {
+			return errors.Fatalf("invalid id %q: %v", snapshotIDString, err)
+		}
+	}
+
+	sn, err := restic.LoadSnapshot(ctx, repo, id)
+	if err != nil {
+		return errors.Fatalf("loading snapshot %q failed: %v", snapshotIDString, err)
+	}
+
+	if sn.Tree == nil {
+		return errors.Fatalf("snapshot %v has no tree", id.Str())
+	}
+
+	password, err := getBundlePassword(gopts, opts.BundlePasswordFile, true)
+	if err != nil {
+		return err
+	}
+
+	params := repository.Params
+	if params == nil {
+		p, err := crypto.Calibrate(repository.KDFTimeout, repository.KDFMemory)
+		if err != nil {
+			return errors.Wrap(err, "Calibrate")
+		}
+		params = &p
+	}
+
+	if filename != "-" {
+		var f *os.File
+		f, err = fs.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			return errors.Fatalf("unable to create bundle: %v", err)
+		}
+
+		defer func() {
+			cerr := f.Close()
+			if err == nil && cerr != nil {
+				err = errors.Fatalf("unable to write bundle: %v", cerr)
+			}
+			if err != nil {
+				// do not leave incomplete bundles behind
+				_ = fs.Remove(filename)
+			}
+		}()
+		wr = f
+	}
+
+	Verbosef("exporting %s\n", sn)
+
+	hostname, _ := os.Hostname()
+	bw, err := bundle.NewWriter(wr, password, *params, hostname)
+	if err != nil {
+		return err
+	}
+
+	blobs, err := exportBlobs(ctx, repo, bw, *sn.Tree)
+	if err != nil {
+		return err
+	}
+
+	err = bw.WriteSnapshot(sn)
+	if err != nil {
+		return err
+	}
+
+	err = bw.Close()
+	if err != nil {
+		return err
+	}
+
+	Verbosef("exported snapshot %v with %d blobs\n", id.Str(), blobs)
+	return nil
+}
+
+// exportBlobs writes all trees and data blobs referenced by the tree to the
+// bundle, ordered by their location in the repository. Returned is the number
+// of blobs.
+func exportBlobs(ctx context.Context, repo restic.Repository, bw *bundle.Writer, tree restic.ID) (int, error) {
+	used := restic.NewBlobSet()
+	err := restic.FindUsedBlobs(ctx, repo, tree, used, restic.NewBlobSet())
+	if err != nil {
+		return 0, err
+	}
+
+	blobs := make([]restic.PackedBlob, 0, len(used))
+	for h := range used {
+		list, found := repo.Index().Lookup(h.ID, h.Type)
+		if !found {
+			return 0, errors.Errorf("blob %v not found in index", h)
+		}
+		blobs = append(blobs, list[0])
+	}
+
+	// read the blobs in the order in which they are stored
+	sort.Slice(blobs, func(i, j int) bool {
+		if blobs[i].PackID != blobs[j].PackID {
+			return bytes.Compare(blobs[i].PackID[:], blobs[j].PackID[:]) < 0
+		}
+		return blobs[i].Offset < blobs[j].Offset
+	})
+
+	var buf []byte
+	for _, pb := range blobs {
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		size := restic.PlaintextLength(int(pb.Length))
+		buf = buf[:cap(buf)]
+		if len(buf) < restic.CiphertextLength(size) {
+			buf = restic.NewBlobBuffer(size)
+		}
+
+		n, err := repo.LoadBlob(ctx, pb.Type, pb.ID, buf)
+		if err != nil {
+			return 0, err
+		}
+
+		debug.Log("export blob %v", pb)
+		err = bw.WriteBlob(pb.Type, buf[:n])
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(blobs), nil
+}
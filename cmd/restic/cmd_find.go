@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,9 +24,18 @@ var cmdFind = &cobra.Command{
 	Long: `
 The "find" command searches for files or directories in snapshots stored in the
 repo.
-It can also be used to search for restic blobs or trees for troubleshooting.`,
+It can also be used to search for restic blobs or trees for troubleshooting.
+
+The results can be restricted with the options --size, --owner and --type. The
+size can be given with a unit (K, M, G or T), "+100M" matches files larger
+than 100 MiB, "-1K" matches files smaller than 1 KiB. When only these options
+are used, the pattern can be omitted. With --oldest-snapshot or
+--newest-snapshot, only the matches in the oldest or newest snapshot
+containing any match are printed.`,
 	Example: `restic find config.json
 restic find --json "*.yml" "*.json"
+restic find --size +2G --type f --newest-snapshot "*.log"
+restic find --owner www-data /var/www
 restic find --json --blob 420f620f b46ebe8a ddd38656
 restic find --show-pack-id --blob 420f620f
 restic find --tree 577c2bc9 f81f2e22 a62827a9
@@ -48,6 +60,11 @@ type FindOptions struct {
 	Host               string
 	Paths              []string
 	Tags               restic.TagLists
+	Size               string
+	Owner              string
+	Type               string
+	OldestSnapshot     bool
+	NewestSnapshot     bool
 }
 
 var findOptions FindOptions
@@ -65,6 +82,11 @@ func init() {
 	f.BoolVar(&findOptions.ShowPackID, "show-pack-id", false, "display the pack-ID the blobs belong to (with --blob or --tree)")
 	f.BoolVarP(&findOptions.CaseInsensitive, "ignore-case", "i", false, "ignore case for pattern")
 	f.BoolVarP(&findOptions.ListLong, "long", "l", false, "use a long listing format showing size and mode")
+	f.StringVar(&findOptions.Size, "size", "", "only match files of `size`, prefix with + or - for larger or smaller files (e.g. +100M)")
+	f.StringVar(&findOptions.Owner, "owner", "", "only match files owned by this `user` (name or numeric ID)")
+	f.StringVar(&findOptions.Type, "type", "", "only match items of this `type`: f (file), d (directory) or l (symlink)")
+	f.BoolVar(&findOptions.OldestSnapshot, "oldest-snapshot", false, "only print the matches in the oldest snapshot containing a match")
+	f.BoolVar(&findOptions.NewestSnapshot, "newest-snapshot", false, "only print the matches in the newest snapshot containing a match")
 
 	f.StringVarP(&findOptions.Host, "host", "H", "", "only consider snapshots for this `host`, when no snapshot ID is given")
 	f.Var(&findOptions.Tags, "tag", "only consider snapshots which include this `taglist`, when no snapshot-ID is given")
@@ -75,6 +97,87 @@ type findPattern struct {
 	oldest, newest time.Time
 	pattern        []string
 	ignoreCase     bool
+	size           *sizeFilter
+	owner          string
+	nodeType       string
+}
+
+// sizeFilter matches the size of a node. If op is '+' or '-', larger or
+// smaller nodes match, otherwise the size must be equal.
+type sizeFilter struct {
+	op   byte
+	size uint64
+}
+
+func (f sizeFilter) match(size uint64) bool {
+	switch f.op {
+	case '+':
+		return size > f.size
+	case '-':
+		return size < f.size
+	}
+	return size == f.size
+}
+
+// parseSizeFilter parses a size like "+100M", the units K, M, G and T are
+// powers of 1024.
+func parseSizeFilter(str string) (*sizeFilter, error) {
+	f := &sizeFilter{}
+	s := str
+	if s != "" && (s[0] == '+' || s[0] == '-') {
+		f.op = s[0]
+		s = s[1:]
+	}
+
+	var unit uint64 = 1
+	if s != "" {
+		switch s[len(s)-1] {
+		case 'k', 'K':
+			unit = 1 << 10
+		case 'm', 'M':
+			unit = 1 << 20
+		case 'g', 'G':
+			unit = 1 << 30
+		case 't', 'T':
+			unit = 1 << 40
+		}
+		if unit > 1 {
+			s = s[:len(s)-1]
+		}
+	}
+
+	n, err := strconv.ParseUint(s, 10, 64)
+	if err != nil || n > math.MaxUint64/unit {
+		return nil, errors.Fatalf("invalid size %q", str)
+	}
+
+	f.size = n * unit
+	return f, nil
+}
+
+// findNodeTypes maps the arguments for --type to node types.
+var findNodeTypes = map[string]string{
+	"f": "file",
+	"d": "dir",
+	"l": "symlink",
+}
+
+// matchNode returns true if the node matches the size, owner and type given by
+// the user.
+func (pat findPattern) matchNode(node *restic.Node) bool {
+	if pat.nodeType != "" && node.Type != pat.nodeType {
+		return false
+	}
+
+	if pat.size != nil && !pat.size.match(node.Size) {
+		return false
+	}
+
+	if pat.owner != "" && pat.owner != node.User && pat.owner != strconv.FormatUint(uint64(node.UID), 10) {
+		return false
+	}
+
+	return true
 }
 
 var timeFormats = []string{
@@ -248,6 +351,7 @@ type Finder struct {
 	blobIDs     map[string]struct{}
 	treeIDs     map[string]struct{}
 	itemsFound  int
+	matches     int
 }
 
 func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error {
@@ -328,8 +432,14 @@ func (f *Finder) findInSnapshot(ctx context.Context, sn *restic.Snapshot) error
 			return ignoreIfNoMatch, errIfNoMatch
 		}
 
+		if !f.pat.matchNode(node) {
+			debug.Log("    size, owner or type do not match\n")
+			return ignoreIfNoMatch, errIfNoMatch
+		}
+
 		debug.Log("    found match\n")
 		f.out.PrintPattern(nodepath, node)
+		f.matches++
 		return false, nil
 	})
 }
@@ -483,13 +593,43 @@ func (f *Finder) findObjectsPacks(ctx context.Context) {
 	}
 }
 
+// findInFirstSnapshot searches the snapshots ordered by time, starting with
+// the oldest or newest one, and stops after the first snapshot which contains
+// a match.
+func (f *Finder) findInFirstSnapshot(ctx context.Context, snapshots restic.Snapshots, oldest bool) error {
+	// restic.Snapshots sorts the newest snapshot first
+	if oldest {
+		sort.Sort(sort.Reverse(snapshots))
+	} else {
+		sort.Sort(snapshots)
+	}
+
+	for _, sn := range snapshots {
+		if err := f.findInSnapshot(ctx, sn); err != nil {
+			return err
+		}
+
+		if f.matches > 0 {
+			break
+		}
+	}
+
+	return nil
+}
+
 func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
+	hasPredicates := opts.Size != "" || opts.Owner != "" || opts.Type != ""
 	if len(args) == 0 {
-		return errors.Fatal("wrong number of arguments")
+		if !hasPredicates {
+			return errors.Fatal("wrong number of arguments")
+		}
+
+		// match all items with the given size, owner or type
+		args = []string{"*"}
 	}
 
 	var err error
-	pat := findPattern{pattern: args}
+	pat := findPattern{pattern: args, owner: opts.Owner}
 	if opts.CaseInsensitive {
 		for i := range pat.pattern {
 			pat.pattern[i] = strings.ToLower(pat.pattern[i])
@@ -509,6 +649,19 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		}
 	}
 
+	if opts.Size != "" {
+		if pat.size, err = parseSizeFilter(opts.Size); err != nil {
+			return err
+		}
+	}
+
+	if opts.Type != "" {
+		var ok bool
+		if pat.nodeType, ok = findNodeTypes[opts.Type]; !ok {
+			return errors.Fatalf("invalid type %q, must be one of f, d or l", opts.Type)
+		}
+	}
+
 	// Check at most only one kind of IDs is provided: currently we
 	// can't mix types
 	if (opts.BlobID && opts.TreeID) ||
@@ -517,6 +670,15 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		return errors.Fatal("cannot have several ID types")
 	}
 
+	searchIDs := opts.BlobID || opts.TreeID || opts.PackID
+	if searchIDs && (hasPredicates || opts.OldestSnapshot || opts.NewestSnapshot) {
+		return errors.Fatal("--size, --owner, --type, --oldest-snapshot and --newest-snapshot cannot be used when searching for IDs")
+	}
+
+	if opts.OldestSnapshot && opts.NewestSnapshot {
+		return errors.Fatal("--oldest-snapshot and --newest-snapshot cannot be used together")
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
@@ -561,6 +723,20 @@ func runFind(opts FindOptions, gopts GlobalOptions, args []string) error {
 		f.packsToBlobs(ctx, []string{f.pat.pattern[0]}) // TODO: support multiple packs
 	}
 
+	if opts.OldestSnapshot || opts.NewestSnapshot {
+		var snapshots restic.Snapshots
+		for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Snapshots) {
+			snapshots = append(snapshots, sn)
+		}
+
+		err = f.findInFirstSnapshot(ctx, snapshots, opts.OldestSnapshot)
+		if err != nil {
+			return err
+		}
+		f.out.Finish()
+		return nil
+	}
+
 	for sn := range FindFilteredSnapshots(ctx, repo, opts.Host, opts.Tags, opts.Paths, opts.Snapshots) {
 		if f.blobIDs != nil || f.treeIDs != nil {
 			if err = f.findIDs(ctx, sn); err != nil && err.Error() != "OK" {
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestParseSizeFilter(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  sizeFilter
+	}{
+		{"0", sizeFilter{size: 0}},
+		{"123", sizeFilter{size: 123}},
+		{"+123", sizeFilter{op: '+', size: 123}},
+		{"-123", sizeFilter{op: '-', size: 123}},
+		{"1k", sizeFilter{size: 1024}},
+		{"+100M", sizeFilter{op: '+', size: 100 * 1024 * 1024}},
+		{"-2G", sizeFilter{op: '-', size: 2 * 1024 * 1024 * 1024}},
+		{"3T", sizeFilter{size: 3 * 1024 * 1024 * 1024 * 1024}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			f, err := parseSizeFilter(test.input)
+			rtest.OK(t, err)
+			rtest.Equals(t, test.want, *f)
+		})
+	}
+
+	for _, input := range []string{"", "+", "M", "1.5M", "--1", "100X", "20000000T"} {
+		t.Run(input, func(t *testing.T) {
+			_, err := parseSizeFilter(input)
+			rtest.Assert(t, err != nil, "invalid size %q was accepted", input)
+		})
+	}
+}
+
+func TestSizeFilterMatch(t *testing.T) {
+	rtest.Assert(t, sizeFilter{op: '+', size: 10}.match(11), "11 is not larger than 10")
+	rtest.Assert(t, !sizeFilter{op: '+', size: 10}.match(10), "10 is larger than 10")
+	rtest.Assert(t, sizeFilter{op: '-', size: 10}.match(9), "9 is not smaller than 10")
+	rtest.Assert(t, !sizeFilter{op: '-', size: 10}.match(10), "10 is smaller than 10")
+	rtest.Assert(t, sizeFilter{size: 10}.match(10), "10 does not equal 10")
+	rtest.Assert(t, !sizeFilter{size: 10}.match(11), "11 equals 10")
+}
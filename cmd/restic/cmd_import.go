@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/restic/restic/internal/bundle"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"github.com/spf13/cobra"
+)
+
+var cmdImport = &cobra.Command{
+	Use:   "import [flags] file",
+	Short: "Import a snapshot from a bundle file",
+	Long: `
+The "import" command adds the snapshot contained in a bundle, which has been
+created with the "export" command, to the repository. Data which is already
+stored in the repository is not added again. The snapshot is only saved
+after the complete bundle has been read and verified.
+
+If the file is "-", the bundle is read from stdin. The repository password
+must then be passed with --password-file or $RESTIC_PASSWORD, and the bundle
+password with --bundle-password-file.
+`,
+	DisableAutoGenTag: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return runImport(importOptions, globalOptions, args)
+	},
+}
+
+// ImportOptions collects all options for the import command.
+type ImportOptions struct {
+	BundlePasswordFile string
+}
+
+var importOptions ImportOptions
+
+func init() {
+	cmdRoot.AddCommand(cmdImport)
+
+	flags := cmdImport.Flags()
+	flags.StringVar(&importOptions.BundlePasswordFile, "bundle-password-file", "", "read the password for the bundle from a `file`")
+}
+
+func runImport(opts ImportOptions, gopts GlobalOptions, args []string) error {
+	ctx := gopts.ctx
+
+	if len(args) != 1 {
+		return errors.Fatal("please specify the bundle file to import")
+	}
+
+	filename := args[0]
+
+	var rd io.Reader = os.Stdin
+	if filename != "-" {
+		f, err := fs.Open(filename)
+		if err != nil {
+			return errors.Fatalf("unable to open bundle: %v", err)
+		}
+		defer f.Close()
+		rd = f
+	} else {
+		if opts.BundlePasswordFile == "" && testBundlePassword == "" {
+			return errors.Fatal("reading the bundle from stdin requires --bundle-password-file")
+		}
+		if gopts.password == "" {
+			return errors.Fatal("unable to read the repository password from stdin when the bundle is read from stdin, use --password-file or $RESTIC_PASSWORD")
+		}
+	}
+
+	br, err := bundle.NewReader(rd)
+	if err != nil {
+		return errors.Fatalf("unable to read bundle: %v", err)
+	}
+
+	repo, err := OpenRepository(gopts)
+	if err != nil {
+		return err
+	}
+
+	lock, err := lockRepo(repo)
+	defer unlockRepo(lock)
+	if err != nil {
+		return err
+	}
+
+	err = repo.LoadIndex(ctx)
+	if err != nil {
+		return err
+	}
+
+	password, err := getBundlePassword(gopts, opts.BundlePasswordFile, false)
+	if err != nil {
+		return err
+	}
+
+	err = br.Unlock(password)
+	if err == bundle.ErrWrongPassword {
+		return errors.Fatal("wrong password for bundle")
+	}
+	if err != nil {
+		return err
+	}
+
+	Verbosef("importing bundle created at %v on %v\n", br.Created().Local().Format(TimeFormat), br.Hostname())
+
+	sn, stats, err := importBundle(ctx, repo, br)
+	if err != nil {
+		return err
+	}
+
+	id, err := repo.SaveJSONUnpacked(ctx, restic.SnapshotFile, sn)
+	if err != nil {
+		return errors.Wrap(err, "SaveJSONUnpacked")
+	}
+
+	Verbosef("added %d of %d blobs, %d blobs were already stored\n", stats.added, stats.blobs, stats.blobs-stats.added)
+	Printf("imported snapshot %v\n", id.Str())
+
+	return nil
+}
+
+type importStats struct {
+	blobs, added int
+}
+
+// importBundle saves all blobs contained in the bundle in the repository and
+// returns the snapshot. Before it is returned, all blobs referenced by the
+// snapshot are checked to be present in the repository.
+func importBundle(ctx context.Context, repo *repository.Repository, br *bundle.Reader) (*restic.Snapshot, importStats, error) {
+	var (
+		sn    *restic.Snapshot
+		stats importStats
+	)
+
+	for {
+		if ctx.Err() != nil {
+			return nil, stats, ctx.Err()
+		}
+
+		rec, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, stats, errors.Fatalf("unable to read bundle: %v", err)
+		}
+
+		switch rec.Type {
+		case bundle.DataBlobRecord, bundle.TreeBlobRecord:
+			stats.blobs++
+
+			tpe := rec.Type.BlobType()
+			id := restic.Hash(rec.Data)
+			if repo.Index().Has(id, tpe) {
+				continue
+			}
+			if err := repo.Index().Err(); err != nil {
+				return nil, stats, err
+			}
+
+			debug.Log("import %v blob %v", tpe, id.Str())
+			_, err = repo.SaveBlob(ctx, tpe, rec.Data, id)
+			if err != nil {
+				return nil, stats, err
+			}
+			stats.added++
+
+		case bundle.SnapshotRecord:
+			if sn != nil {
+				return nil, stats, errors.Fatal("bundle contains more than one snapshot")
+			}
+
+			sn, err = bundle.DecodeSnapshot(rec)
+			if err != nil {
+				return nil, stats, err
+			}
+
+		default:
+			return nil, stats, errors.Fatalf("bundle contains unknown record type %d", rec.Type)
+		}
+	}
+
+	if sn == nil || sn.Tree == nil {
+		return nil, stats, errors.Fatal("bundle does not contain a snapshot")
+	}
+
+	err := repo.Flush(ctx)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	err = repo.SaveIndex(ctx)
+	if err != nil {
+		return nil, stats, err
+	}
+
+	// make sure that the snapshot is complete before saving it
+	used := restic.NewBlobSet()
+	err = restic.FindUsedBlobs(ctx, repo, *sn.Tree, used, restic.NewBlobSet())
+	if err != nil {
+		return nil, stats, errors.Fatalf("snapshot in bundle is incomplete: %v", err)
+	}
+
+	for h := range used {
+		if !repo.Index().Has(h.ID, h.Type) {
+			if err := repo.Index().Err(); err != nil {
+				return nil, stats, err
+			}
+			return nil, stats, errors.Fatalf("snapshot in bundle is incomplete: blob %v is missing", h)
+		}
+	}
+
+	return sn, stats, nil
+}
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 
@@ -12,22 +15,93 @@ var cmdInit = &cobra.Command{
 	Short: "Initialize a new repository",
 	Long: `
 The "init" command initializes a new repository.
+
+The parameters for the key derivation function (scrypt) are calibrated on the
+current machine so that unlocking the repository takes about 0.5 to 1 seconds.
+The target time and the memory usage can be adjusted with --kdf-time and
+--kdf-memory, or the parameters can be set explicitly with --kdf-n, --kdf-r
+and --kdf-p.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		return runInit(globalOptions, args)
+		return runInit(initOptions, globalOptions, args)
 	},
 }
 
+// InitOptions bundles all options for the init command.
+type InitOptions struct {
+	KDFTime   time.Duration
+	KDFMemory int
+	KDFN      int
+	KDFR      int
+	KDFP      int
+}
+
+var initOptions InitOptions
+
 func init() {
 	cmdRoot.AddCommand(cmdInit)
+
+	f := cmdInit.Flags()
+	f.DurationVar(&initOptions.KDFTime, "kdf-time", 0, "calibrate the KDF so that unlocking the repository takes at most `duration` (default: 1s)")
+	f.IntVar(&initOptions.KDFMemory, "kdf-memory", 0, "limit the memory used by the KDF to `n` MiB (default: 60)")
+	f.IntVar(&initOptions.KDFN, "kdf-n", 0, "use the scrypt parameter N instead of calibrating it (power of two)")
+	f.IntVar(&initOptions.KDFR, "kdf-r", 0, "use the scrypt parameter r instead of calibrating it")
+	f.IntVar(&initOptions.KDFP, "kdf-p", 0, "use the scrypt parameter p instead of calibrating it")
 }
 
-func runInit(gopts GlobalOptions, args []string) error {
+// applyKDFOptions configures how the KDF parameters for the new key are
+// determined. When any of the scrypt parameters is given explicitly,
+// calibration is skipped and missing parameters are set to the defaults.
+func applyKDFOptions(opts InitOptions) error {
+	if opts.KDFTime < 0 || opts.KDFMemory < 0 {
+		return errors.Fatal("--kdf-time and --kdf-memory must not be negative")
+	}
+
+	if opts.KDFTime > 0 {
+		repository.KDFTimeout = opts.KDFTime
+	}
+
+	if opts.KDFMemory > 0 {
+		repository.KDFMemory = opts.KDFMemory
+	}
+
+	if opts.KDFN == 0 && opts.KDFR == 0 && opts.KDFP == 0 {
+		return nil
+	}
+
+	if opts.KDFTime > 0 || opts.KDFMemory > 0 {
+		return errors.Fatal("--kdf-time and --kdf-memory cannot be combined with explicit KDF parameters")
+	}
+
+	params := crypto.DefaultKDFParams
+	if opts.KDFN != 0 {
+		params.N = opts.KDFN
+	}
+	if opts.KDFR != 0 {
+		params.R = opts.KDFR
+	}
+	if opts.KDFP != 0 {
+		params.P = opts.KDFP
+	}
+
+	if err := params.Check(); err != nil {
+		return errors.Fatalf("invalid KDF parameters: %v", err)
+	}
+
+	repository.Params = &params
+	return nil
+}
+
+func runInit(opts InitOptions, gopts GlobalOptions, args []string) error {
 	if gopts.Repo == "" {
 		return errors.Fatal("Please specify repository location (-r)")
 	}
 
+	if err := applyKDFOptions(opts); err != nil {
+		return err
+	}
+
 	be, err := create(gopts.Repo, gopts.extended)
 	if err != nil {
 		return errors.Fatalf("create repository at %s failed: %v\n", gopts.Repo, err)
@@ -48,6 +122,10 @@ func runInit(gopts GlobalOptions, args []string) error {
 	}
 
 	Verbosef("created restic repository %v at %s\n", s.Config().ID[:10], gopts.Repo)
+	if gopts.verbosity >= 2 && repository.Params != nil {
+		p := repository.Params
+		Verbosef("using KDF parameters N=%d, r=%d, p=%d\n", p.N, p.R, p.P)
+	}
 	Verbosef("\n")
 	Verbosef("Please note that knowledge of your password is required to access\n")
 	Verbosef("the repository. Losing your password means that your data is\n")
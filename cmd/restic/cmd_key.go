@@ -20,6 +20,15 @@ var cmdKey = &cobra.Command{
 	Short: "Manage keys (passwords)",
 	Long: `
 The "key" command manages keys (passwords) for accessing the repository.
+
+With "add --read-only", a restore-only key is created. It can be used to list,
+check and restore snapshots, but restic refuses to create or remove any files
+in the repository (except for locks) when it is used. Note that this is
+enforced by the client: a user who knows the password of a restore-only key
+can decrypt all data, and a modified client could still write to the
+repository if the storage permits it. Older versions of restic ignore the
+restriction and grant full write and delete access with a restore-only key,
+so it is only advisory unless all clients have been upgraded.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -27,13 +36,17 @@ The "key" command manages keys (passwords) for accessing the repository.
 	},
 }
 
-var newPasswordFile string
+var (
+	newPasswordFile string
+	keyReadOnly     bool
+)
 
 func init() {
 	cmdRoot.AddCommand(cmdKey)
 
 	flags := cmdKey.Flags()
 	flags.StringVarP(&newPasswordFile, "new-password-file", "", "", "the file from which to load a new password")
+	flags.BoolVar(&keyReadOnly, "read-only", false, "create a restore-only key which cannot be used to modify the repository (add)")
 }
 
 func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions) error {
@@ -43,6 +56,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 		UserName string `json:"userName"`
 		HostName string `json:"hostName"`
 		Created  string `json:"created"`
+		ReadOnly bool   `json:"readOnly"`
 	}
 
 	var keys []keyInfo
@@ -60,6 +74,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 			UserName: k.Username,
 			HostName: k.Hostname,
 			Created:  k.Created.Local().Format(TimeFormat),
+			ReadOnly: k.ReadOnly,
 		}
 
 		keys = append(keys, key)
@@ -79,6 +94,7 @@ func listKeys(ctx context.Context, s *repository.Repository, gopts GlobalOptions
 	tab.AddColumn("User", "{{ .UserName }}")
 	tab.AddColumn("Host", "{{ .HostName }}")
 	tab.AddColumn("Created", "{{ .Created }}")
+	tab.AddColumn("Access", "{{if .ReadOnly}}restore-only{{else}}full{{end}}")
 
 	for _, key := range keys {
 		tab.AddRow(key)
@@ -109,18 +125,22 @@ func getNewPassword(gopts GlobalOptions) (string, error) {
 		"enter password again: ")
 }
 
-func addKey(gopts GlobalOptions, repo *repository.Repository) error {
+func addKey(gopts GlobalOptions, repo *repository.Repository, readOnly bool) error {
 	pw, err := getNewPassword(gopts)
 	if err != nil {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key(), readOnly)
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
 
-	Verbosef("saved new key as %s\n", id)
+	if readOnly {
+		Verbosef("saved new restore-only key as %s\n", id)
+	} else {
+		Verbosef("saved new key as %s\n", id)
+	}
 
 	return nil
 }
@@ -146,7 +166,7 @@ func changePassword(gopts GlobalOptions, repo *repository.Repository) error {
 		return err
 	}
 
-	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key())
+	id, err := repository.AddKey(gopts.ctx, repo, pw, repo.Key(), false)
 	if err != nil {
 		return errors.Fatalf("creating new key failed: %v\n", err)
 	}
@@ -170,11 +190,19 @@ func runKey(gopts GlobalOptions, args []string) error {
 	ctx, cancel := context.WithCancel(gopts.ctx)
 	defer cancel()
 
+	if keyReadOnly && args[0] != "add" {
+		return errors.Fatal("--read-only can only be used with \"add\"")
+	}
+
 	repo, err := OpenRepository(gopts)
 	if err != nil {
 		return err
 	}
 
+	if repo.ReadOnly() && args[0] != "list" {
+		return errors.Fatal("keys cannot be managed with a restore-only key")
+	}
+
 	switch args[0] {
 	case "list":
 		lock, err := lockRepo(repo)
@@ -191,7 +219,7 @@ func runKey(gopts GlobalOptions, args []string) error {
 			return err
 		}
 
-		return addKey(gopts, repo)
+		return addKey(gopts, repo, keyReadOnly)
 	case "remove":
 		lock, err := lockRepoExclusive(repo)
 		defer unlockRepo(lock)
@@ -44,6 +44,15 @@ You need to specify a sample format for exactly the following timestamp:
 
 For details please see the documentation for time.Format() at:
   https://godoc.org/time#Time.Format
+
+Filtering Snapshots
+===================
+
+By default, all snapshots in the repository are made available. The options
+--host, --tag and --path limit the mount to the snapshots which match all of
+the given filters, this also applies to the "hosts" and "tags" directories.
+When --tag is given several times, snapshots matching any of the tag lists
+are included.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
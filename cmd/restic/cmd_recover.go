@@ -59,6 +59,9 @@ func runRecover(gopts GlobalOptions) error {
 		}
 		trees[blob.Blob.ID] = false
 	}
+	if err = repo.Index().Err(); err != nil {
+		return err
+	}
 
 	cur := 0
 	max := len(trees)
@@ -1,12 +1,15 @@
 package main
 
 import (
+	"fmt"
+	"sort"
+	"strings"
+
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/restorer"
-	"strings"
 
 	"github.com/spf13/cobra"
 )
@@ -20,6 +23,13 @@ a directory.
 
 The special snapshot "latest" can be used to restore the latest snapshot in the
 repository.
+
+Errors while restoring metadata (owner, permissions, timestamps or extended
+attributes) do not stop the restore, they are collected and summarized at the
+end. Pass --fail-on-metadata-error to abort the restore on the first such
+error instead. Errors for creating or writing files are always reported
+individually. When restoring as a user which cannot change the owner of files,
+use --no-owner to not restore the owner at all.
 `,
 	DisableAutoGenTag: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
@@ -38,6 +48,8 @@ type RestoreOptions struct {
 	Paths              []string
 	Tags               restic.TagLists
 	Verify             bool
+	NoOwner            bool
+	FailOnMetadata     bool
 }
 
 var restoreOptions RestoreOptions
@@ -56,6 +68,8 @@ func init() {
 	flags.Var(&restoreOptions.Tags, "tag", "only consider snapshots which include this `taglist` for snapshot ID \"latest\"")
 	flags.StringArrayVar(&restoreOptions.Paths, "path", nil, "only consider snapshots which include this (absolute) `path` for snapshot ID \"latest\"")
 	flags.BoolVar(&restoreOptions.Verify, "verify", false, "verify restored files content")
+	flags.BoolVar(&restoreOptions.NoOwner, "no-owner", false, "do not restore the owner and group of files and directories")
+	flags.BoolVar(&restoreOptions.FailOnMetadata, "fail-on-metadata-error", false, "abort the restore if metadata cannot be restored")
 }
 
 func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
@@ -127,8 +141,21 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		Exitf(2, "creating restorer failed: %v\n", err)
 	}
 
+	res.NoOwner = opts.NoOwner
+
 	totalErrors := 0
+	metadataErrors := newRestoreErrorSummary()
 	res.Error = func(location string, err error) error {
+		if isMetadataError(err) {
+			if opts.FailOnMetadata {
+				return err
+			}
+
+			debug.Log("collecting error for %s: %v", location, err)
+			metadataErrors.Add(location, err)
+			return nil
+		}
+
 		Warnf("ignoring error for %s: %s\n", location, err)
 		totalErrors++
 		return nil
@@ -187,8 +214,62 @@ func runRestore(opts RestoreOptions, gopts GlobalOptions, args []string) error {
 		count, err = res.VerifyFiles(ctx, opts.Target)
 		Verbosef("finished verifying %d files in %s\n", count, opts.Target)
 	}
+	metadataErrors.Print()
 	if totalErrors > 0 {
 		Printf("There were %d errors\n", totalErrors)
 	}
 	return err
 }
+
+// isMetadataError returns true if err occurred while restoring metadata.
+// Errors for creating or writing files are not metadata errors, even if they
+// were caused by missing permissions.
+func isMetadataError(err error) bool {
+	_, ok := errors.Cause(err).(*restic.MetadataError)
+	return ok
+}
+
+// restoreErrorSummary collects metadata errors which were ignored during a
+// restore, grouped by the failed operation.
+type restoreErrorSummary struct {
+	count  map[string]int
+	total  int
+	groups []string
+}
+
+func newRestoreErrorSummary() *restoreErrorSummary {
+	return &restoreErrorSummary{count: make(map[string]int)}
+}
+
+// Add records the error err for the item at location. The individual errors
+// are printed only with increased verbosity.
+func (s *restoreErrorSummary) Add(location string, err error) {
+	group := err.Error()
+	if merr, ok := errors.Cause(err).(*restic.MetadataError); ok {
+		group = fmt.Sprintf("%s: %v", merr.Op, merr.Err)
+	}
+
+	if _, ok := s.count[group]; !ok {
+		s.groups = append(s.groups, group)
+	}
+	s.count[group]++
+	s.total++
+
+	if globalOptions.verbosity >= 2 {
+		Printf("ignoring error for %s: %s\n", location, err)
+	}
+}
+
+// Print writes the summary, if any errors have been collected.
+func (s *restoreErrorSummary) Print() {
+	if s.total == 0 {
+		return
+	}
+
+	sort.Strings(s.groups)
+
+	Warnf("Unable to restore all metadata, %d errors were ignored:\n", s.total)
+	for _, group := range s.groups {
+		Warnf("  %s (%d times)\n", group, s.count[group])
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestIsMetadataError(t *testing.T) {
+	permErr := &os.PathError{Op: "open", Path: "/tmp/foo", Err: syscall.EACCES}
+
+	var tests = []struct {
+		err      error
+		metadata bool
+	}{
+		{&restic.MetadataError{Op: "lchown", Path: "/tmp/foo", Err: syscall.EPERM}, true},
+		{errors.Wrap(&restic.MetadataError{Op: "chmod", Path: "/tmp/foo", Err: syscall.EPERM}, "restore"), true},
+		{permErr, false},
+		{errors.Wrap(permErr, "CreateFile"), false},
+		{errors.New("short write"), false},
+	}
+
+	for _, test := range tests {
+		if got := isMetadataError(test.err); got != test.metadata {
+			t.Errorf("isMetadataError(%v) = %v, want %v", test.err, got, test.metadata)
+		}
+	}
+}
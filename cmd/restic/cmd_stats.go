@@ -5,7 +5,6 @@ import (
 	"crypto/sha256"
 	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 
 	"github.com/restic/restic/internal/errors"
@@ -37,6 +36,10 @@ The modes are:
   how many files reference them.
 * blobs-per-file: A combination of files-by-contents and raw-data.
 
+For restore-size and files-by-contents, the statistics of each snapshot are
+kept in the local cache, so snapshots which have been scanned before do not
+need to be walked again. Use --no-cache to disable this.
+
 Refer to the online manual for more details about each mode.
 `,
 	DisableAutoGenTag: true,
@@ -90,6 +93,8 @@ func runStats(gopts GlobalOptions, args []string) error {
 		blobsSeen:   restic.NewBlobSet(),
 	}
 
+	sc := newStatsCache(repo, countMode)
+
 	if snapshotIDString != "" {
 		// scan just a single snapshot
 
@@ -111,16 +116,24 @@ func runStats(gopts GlobalOptions, args []string) error {
 			return errors.Fatalf("error loading snapshot from repo: %v", err)
 		}
 
-		err = statsWalkSnapshot(ctx, snapshot, repo, stats)
+		err = statsSnapshot(ctx, repo, sc, sID, snapshot, stats)
 	} else {
 		// iterate every snapshot in the repo
-		err = repo.List(ctx, restic.SnapshotFile, func(snapshotID restic.ID, size int64) error {
-			snapshot, err := restic.LoadSnapshot(ctx, repo, snapshotID)
+		snapshots := restic.NewIDSet()
+		err = restic.ForAllSnapshots(ctx, repo, func(snapshotID restic.ID, snapshot *restic.Snapshot, err error) error {
 			if err != nil {
 				return fmt.Errorf("Error loading snapshot %s: %v", snapshotID.Str(), err)
 			}
-			return statsWalkSnapshot(ctx, snapshot, repo, stats)
+			snapshots.Insert(snapshotID)
+			return statsSnapshot(ctx, repo, sc, snapshotID, snapshot, stats)
 		})
+
+		if err == nil && sc != nil {
+			// drop cached stats for snapshots which have been removed
+			if cerr := sc.cache.ClearStats(snapshots); cerr != nil {
+				Warnf("unable to clear the stats cache: %v\n", cerr)
+			}
+		}
 	}
 	if err != nil {
 		return err
@@ -139,7 +152,7 @@ func runStats(gopts GlobalOptions, args []string) error {
 	}
 
 	if gopts.JSON {
-		err = json.NewEncoder(os.Stdout).Encode(stats)
+		err = json.NewEncoder(globalOptions.stdout).Encode(stats)
 		if err != nil {
 			return fmt.Errorf("encoding output: %v", err)
 		}
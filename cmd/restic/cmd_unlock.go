@@ -1,6 +1,7 @@
 package main
 
 import (
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/restic"
 	"github.com/spf13/cobra"
 )
@@ -36,6 +37,10 @@ func runUnlock(opts UnlockOptions, gopts GlobalOptions) error {
 		return err
 	}
 
+	if repo.ReadOnly() {
+		return errors.Fatal("removing locks of other processes is not allowed with a restore-only key")
+	}
+
 	fn := restic.RemoveStaleLocks
 	if opts.RemoveAll {
 		fn = restic.RemoveAllLocks
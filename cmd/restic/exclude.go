@@ -14,6 +14,7 @@ import (
 	"github.com/restic/restic/internal/filter"
 	"github.com/restic/restic/internal/fs"
 	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/textfile"
 )
 
 type rejectionCache struct {
@@ -197,9 +198,159 @@ func isDirExcludedByFile(dir, tagFilename, header string) bool {
 	return true
 }
 
+// ignoreFileCache caches the patterns read from the ignore files in each
+// directory, a nil list is stored for directories without an ignore file.
+type ignoreFileCache struct {
+	m   map[string][]string
+	mtx sync.Mutex
+}
+
+// rejectByIgnoreFile returns a RejectByNameFunc which rejects items matching
+// one of the patterns in a file called filename in any of the directories
+// above the item, up to and including the backup target the item belongs to.
+// Like for .gitignore, the patterns in an ignore file are relative to the
+// directory the file is in: a pattern starting with a slash only matches
+// directly below that directory, other patterns match at any level below it.
+func rejectByIgnoreFile(filename string, targets []string) (RejectByNameFunc, error) {
+	if filename == "" {
+		return nil, errors.New("name for ignore file is empty")
+	}
+	if strings.ContainsAny(filename, `/\`) {
+		return nil, errors.Errorf("name for ignore file %q must not contain a directory", filename)
+	}
+	debug.Log("using %q as ignore file", filename)
+
+	// symbolic links in the targets are not resolved, the archiver also
+	// passes the paths below a followed link in terms of the link
+	var roots []string
+	for _, target := range targets {
+		root, err := filepath.Abs(filepath.Clean(target))
+		if err != nil {
+			return nil, err
+		}
+		roots = append(roots, root)
+	}
+
+	c := &ignoreFileCache{m: make(map[string][]string)}
+	return func(item string) bool {
+		item = filepath.Clean(item)
+
+		root := ignoreFileRoot(roots, item)
+		if root == "" || root == item {
+			return false
+		}
+
+		for dir := filepath.Dir(item); ; dir = filepath.Dir(dir) {
+			patterns := c.patterns(dir, filename)
+			if len(patterns) > 0 {
+				rel, err := filepath.Rel(dir, item)
+				if err == nil && isExcludedByIgnoreFile(patterns, string(filepath.Separator)+rel) {
+					debug.Log("path %q excluded by %v", item, filepath.Join(dir, filename))
+					return true
+				}
+			}
+
+			if dir == root || dir == filepath.Dir(dir) {
+				break
+			}
+		}
+
+		return false
+	}, nil
+}
+
+// ignoreFileRoot returns the innermost of roots which contains item, or an
+// empty string if item is not contained in any of them.
+func ignoreFileRoot(roots []string, item string) string {
+	var root string
+	for _, r := range roots {
+		if fs.HasPathPrefix(r, item) && len(r) > len(root) {
+			root = r
+		}
+	}
+
+	return root
+}
+
+// patterns returns the patterns from the ignore file called filename in dir.
+// The file is read without holding the lock, so concurrent callers may read
+// the same file more than once.
+func (c *ignoreFileCache) patterns(dir, filename string) []string {
+	c.mtx.Lock()
+	patterns, ok := c.m[dir]
+	c.mtx.Unlock()
+
+	if ok {
+		return patterns
+	}
+
+	patterns = readIgnoreFile(filepath.Join(dir, filename))
+
+	c.mtx.Lock()
+	c.m[dir] = patterns
+	c.mtx.Unlock()
+
+	return patterns
+}
+
+// readIgnoreFile returns the patterns in the ignore file. Empty lines and
+// comments are skipped. Errors are printed as warnings, the file is then
+// ignored. Invalid patterns are skipped with a warning, so that they are only
+// reported once and not for every item checked against them.
+func readIgnoreFile(filename string) []string {
+	data, err := textfile.Read(filename)
+	if os.IsNotExist(errors.Cause(err)) {
+		return nil
+	}
+	if err != nil {
+		Warnf("could not read ignore file: %v\n", err)
+		return nil
+	}
+
+	var patterns []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := checkIgnorePattern(line); err != nil {
+			Warnf("ignore file %v: invalid pattern %q: %v\n", filename, line, err)
+			continue
+		}
+		patterns = append(patterns, line)
+	}
+
+	return patterns
+}
+
+// checkIgnorePattern returns an error if the pattern is malformed.
+func checkIgnorePattern(pattern string) error {
+	for _, part := range strings.Split(filepath.ToSlash(filepath.Clean(pattern)), "/") {
+		if _, err := filepath.Match(part, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// isExcludedByIgnoreFile returns true if rel, the path of an item relative to
+// the directory of the ignore file, matches one of the patterns. The patterns
+// must have been checked with checkIgnorePattern.
+func isExcludedByIgnoreFile(patterns []string, rel string) bool {
+	matched, _, err := filter.List(patterns, rel)
+	if err != nil {
+		debug.Log("error for pattern in ignore file: %v", err)
+		return false
+	}
+
+	return matched
+}
+
 // gatherDevices returns the set of unique device ids of the files and/or
-// directory paths listed in "items".
-func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
+// directory paths listed in "items". If followSymlinks is set, the device ids
+// of the files symbolic links in items point to are used.
+func gatherDevices(items []string, followSymlinks bool) (deviceMap map[string]uint64, err error) {
 	deviceMap = make(map[string]uint64)
 	for _, item := range items {
 		item, err = filepath.Abs(filepath.Clean(item))
@@ -207,7 +358,12 @@ func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
 			return nil, err
 		}
 
-		fi, err := fs.Lstat(item)
+		stat := fs.Lstat
+		if followSymlinks {
+			stat = fs.Stat
+		}
+
+		fi, err := stat(item)
 		if err != nil {
 			return nil, err
 		}
@@ -224,9 +380,11 @@ func gatherDevices(items []string) (deviceMap map[string]uint64, err error) {
 }
 
 // rejectByDevice returns a RejectFunc that rejects files which are on a
-// different file systems than the files/dirs in samples.
-func rejectByDevice(samples []string) (RejectFunc, error) {
-	allowed, err := gatherDevices(samples)
+// different file systems than the files/dirs in samples. If followSymlinks is
+// set, the file systems of the files symbolic links in samples point to are
+// used.
+func rejectByDevice(samples []string, followSymlinks bool) (RejectFunc, error) {
+	allowed, err := gatherDevices(samples, followSymlinks)
 	if err != nil {
 		return nil, err
 	}
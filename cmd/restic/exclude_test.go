@@ -1,9 +1,11 @@
 package main
 
 import (
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/test"
@@ -189,3 +191,101 @@ func TestMultipleIsExcludedByFile(t *testing.T) {
 		}
 	}
 }
+
+func TestRejectByIgnoreFile(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	ignoreFiles := map[string]string{
+		".resticignore":      "# comment\n*.log\n/build\n\n",
+		"sub/.resticignore":  "/cache\ndata.bin\n",
+		"sub/dir/.gitignore": "*\n",
+	}
+
+	for name, content := range ignoreFiles {
+		filename := filepath.Join(tempDir, filepath.FromSlash(name))
+		test.OK(t, os.MkdirAll(filepath.Dir(filename), 0700))
+		test.OK(t, ioutil.WriteFile(filename, []byte(content), 0600))
+	}
+
+	var tests = []struct {
+		path   string
+		reject bool
+	}{
+		{"foo", false},
+		{".resticignore", false},
+		{"a.log", true},
+		{"sub/b.log", true},
+		{"sub/dir/c.log", true},
+		{"build", true},
+		{"sub/build", false},
+		{"cache", false},
+		{"sub/cache", true},
+		{"sub/dir/cache", false},
+		{"data.bin", false},
+		{"sub/data.bin", true},
+		{"sub/dir/data.bin", true},
+		{"sub/dir/foo", false},
+	}
+
+	reject, err := rejectByIgnoreFile(".resticignore", []string{tempDir})
+	test.OK(t, err)
+
+	for _, tc := range tests {
+		t.Run(tc.path, func(t *testing.T) {
+			item := filepath.Join(tempDir, filepath.FromSlash(tc.path))
+			if got := reject(item); got != tc.reject {
+				t.Fatalf("wrong result for %v, want %v, got %v", tc.path, tc.reject, got)
+			}
+		})
+	}
+
+	// ignore files above the backup target are not used
+	reject, err = rejectByIgnoreFile(".resticignore", []string{filepath.Join(tempDir, "sub")})
+	test.OK(t, err)
+	for _, tc := range []struct {
+		path   string
+		reject bool
+	}{
+		{"sub", false},
+		{"sub/b.log", false},
+		{"sub/cache", true},
+		{"sub/dir/data.bin", true},
+	} {
+		item := filepath.Join(tempDir, filepath.FromSlash(tc.path))
+		if got := reject(item); got != tc.reject {
+			t.Errorf("target sub: wrong result for %v, want %v, got %v", tc.path, tc.reject, got)
+		}
+	}
+
+	for _, name := range []string{"", "foo/.resticignore"} {
+		_, err = rejectByIgnoreFile(name, nil)
+		test.Assert(t, err != nil, "invalid name %q was accepted", name)
+	}
+}
+
+func TestRejectByIgnoreFileInvalidPattern(t *testing.T) {
+	tempDir, cleanup := test.TempDir(t)
+	defer cleanup()
+
+	filename := filepath.Join(tempDir, ".resticignore")
+	test.OK(t, ioutil.WriteFile(filename, []byte("*.log\n[\nfoo\n"), 0600))
+
+	buf := bytes.NewBuffer(nil)
+	stderr := globalOptions.stderr
+	globalOptions.stderr = buf
+	defer func() {
+		globalOptions.stderr = stderr
+	}()
+
+	reject, err := rejectByIgnoreFile(".resticignore", []string{tempDir})
+	test.OK(t, err)
+
+	for _, name := range []string{"a.log", "b", "foo", "c"} {
+		want := name == "a.log" || name == "foo"
+		test.Equals(t, want, reject(filepath.Join(tempDir, name)))
+	}
+
+	// the invalid pattern is only reported once
+	test.Equals(t, 1, strings.Count(buf.String(), "invalid pattern"))
+}
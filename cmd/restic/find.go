@@ -58,18 +58,26 @@ func FindFilteredSnapshots(ctx context.Context, repo *repository.Repository, hos
 			return
 		}
 
-		snapshots, err := restic.FindFilteredSnapshots(ctx, repo, host, tags, paths)
-		if err != nil {
-			Warnf("could not load snapshots: %v\n", err)
-			return
-		}
+		// snapshots are loaded in parallel and passed on as soon as they arrive
+		err := restic.ForAllSnapshots(ctx, repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+			if err != nil {
+				Warnf("could not load snapshot %v: %v\n", id.Str(), err)
+				return nil
+			}
+
+			if (host != "" && host != sn.Hostname) || !sn.HasTagList(tags) || !sn.HasPaths(paths) {
+				return nil
+			}
 
-		for _, sn := range snapshots {
 			select {
 			case <-ctx.Done():
-				return
+				return ctx.Err()
 			case out <- sn:
 			}
+			return nil
+		})
+		if err != nil && ctx.Err() == nil {
+			Warnf("could not load snapshots: %v\n", err)
 		}
 	}()
 	return out
@@ -366,6 +366,26 @@ func OpenRepository(opts GlobalOptions) (*repository.Repository, error) {
 
 	s := repository.New(be)
 
+	idxOpts := repository.IndexOptions{}
+	err = opts.extended.Extract("index").Apply("index", &idxOpts)
+	if err != nil {
+		return nil, err
+	}
+	err = s.SetIndexOptions(idxOpts)
+	if err != nil {
+		return nil, err
+	}
+	AddCleanupHandler(func() error {
+		return s.CloseIndex()
+	})
+
+	treeOpts := repository.NewTreeCacheOptions()
+	err = opts.extended.Extract("trees").Apply("trees", &treeOpts)
+	if err != nil {
+		return nil, err
+	}
+	s.SetTreeCacheOptions(treeOpts)
+
 	opts.password, err = ReadPassword(opts, "enter password for repository: ")
 	if err != nil {
 		return nil, err
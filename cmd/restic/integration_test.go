@@ -13,6 +13,9 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"syscall"
 	"testing"
@@ -50,7 +53,7 @@ func testRunInit(t testing.TB, opts GlobalOptions) {
 	restic.TestDisableCheckPolynomial(t)
 	restic.TestSetLockTimeout(t, 0)
 
-	rtest.OK(t, runInit(opts, nil))
+	rtest.OK(t, runInit(InitOptions{}, opts, nil))
 	t.Logf("repository initialized at %v", opts.Repo)
 }
 
@@ -173,6 +176,10 @@ func testRunLs(t testing.TB, gopts GlobalOptions, snapshotID string) []string {
 }
 
 func testRunFind(t testing.TB, wantJSON bool, gopts GlobalOptions, pattern string) []byte {
+	return testRunFindOptions(t, wantJSON, gopts, FindOptions{}, pattern)
+}
+
+func testRunFindOptions(t testing.TB, wantJSON bool, gopts GlobalOptions, opts FindOptions, patterns ...string) []byte {
 	buf := bytes.NewBuffer(nil)
 	globalOptions.stdout = buf
 	globalOptions.JSON = wantJSON
@@ -181,13 +188,29 @@ func testRunFind(t testing.TB, wantJSON bool, gopts GlobalOptions, pattern strin
 		globalOptions.JSON = false
 	}()
 
-	opts := FindOptions{}
-
-	rtest.OK(t, runFind(opts, gopts, []string{pattern}))
+	rtest.OK(t, runFind(opts, gopts, patterns))
 
 	return buf.Bytes()
 }
 
+func testRunStats(t testing.TB, gopts GlobalOptions, mode string) string {
+	buf := bytes.NewBuffer(nil)
+	globalOptions.stdout = buf
+	gopts.JSON = true
+	defer func() {
+		globalOptions.stdout = os.Stdout
+		countMode = countModeRestoreSize
+		snapshotIDString = ""
+	}()
+
+	countMode = mode
+	snapshotIDString = ""
+
+	rtest.OK(t, runStats(gopts, nil))
+
+	return buf.String()
+}
+
 func testRunSnapshots(t testing.TB, gopts GlobalOptions) (newest *Snapshot, snapmap map[restic.ID]Snapshot) {
 	buf := bytes.NewBuffer(nil)
 	globalOptions.stdout = buf
@@ -436,6 +459,46 @@ func TestBackupExclude(t *testing.T) {
 		"expected file %q not in first snapshot, but it's included", "passwords.txt")
 }
 
+func TestBackupFollowSymlinksExclude(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	files := map[string]string{
+		"srv/site/index.html":    "index",
+		"srv/site/error.log":     "log",
+		"srv/site/tmp/cache":     "cache",
+		"srv/site/.resticignore": "*.log\n",
+	}
+	for name, content := range files {
+		filename := filepath.Join(env.testdata, filepath.FromSlash(name))
+		rtest.OK(t, os.MkdirAll(filepath.Dir(filename), 0755))
+		rtest.OK(t, ioutil.WriteFile(filename, []byte(content), 0644))
+	}
+	rtest.OK(t, os.MkdirAll(filepath.Join(env.testdata, "var"), 0755))
+	rtest.OK(t, os.Symlink(filepath.Join(env.testdata, "srv", "site"), filepath.Join(env.testdata, "var", "www")))
+
+	// the exclude functions must see the paths below the link
+	opts := BackupOptions{
+		ExcludeOtherFS: true,
+		FollowSymlinks: true,
+		IgnoreFiles:    []string{".resticignore"},
+		Excludes:       []string{filepath.Join(env.testdata, "var", "www", "tmp")},
+	}
+	testRunBackup(t, "", []string{filepath.Join(env.testdata, "var", "www")}, opts, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	www := filepath.ToSlash(filepath.Join(env.testdata, "var", "www"))
+	ls := testRunLs(t, env.gopts, snapshotIDs[0].String())
+	rtest.Assert(t, includes(ls, www+"/index.html"), "index.html is missing from the snapshot: %v", ls)
+	rtest.Assert(t, includes(ls, www+"/.resticignore"), ".resticignore is missing from the snapshot: %v", ls)
+	rtest.Assert(t, !includes(ls, www+"/error.log"), "error.log was not excluded by the ignore file: %v", ls)
+	rtest.Assert(t, !includes(ls, www+"/tmp"), "tmp was not excluded by pattern: %v", ls)
+}
+
 const (
 	incrementalFirstWrite  = 10 * 1042 * 1024
 	incrementalSecondWrite = 1 * 1042 * 1024
@@ -683,6 +746,63 @@ func TestKeyAddRemove(t *testing.T) {
 	testRunCheck(t, env.gopts)
 }
 
+func TestKeyReadOnly(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	keyReadOnly = true
+	testRunKeyAddNewKey(t, "restore only", env.gopts)
+	keyReadOnly = false
+
+	gopts := env.gopts
+	gopts.password = "restore only"
+
+	// the key can be used to check and restore the repository
+	testRunCheck(t, gopts)
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, gopts, restoredir, snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+
+	// but it cannot be used to modify it
+	err := runForget(ForgetOptions{}, gopts, []string{snapshotIDs[0].String()})
+	rtest.Assert(t, err != nil, "snapshot was removed with a restore-only key")
+
+	testKeyNewPassword = "another key"
+	err = runKey(gopts, []string{"add"})
+	testKeyNewPassword = ""
+	rtest.Assert(t, err != nil, "key was added with a restore-only key")
+
+	// neither exclusive locks nor the locks of other processes can be touched
+	repo, err := OpenRepository(gopts)
+	rtest.OK(t, err)
+	_, err = lockRepoExclusive(repo)
+	rtest.Assert(t, err != nil, "exclusive lock was created with a restore-only key")
+
+	repo, err = OpenRepository(env.gopts)
+	rtest.OK(t, err)
+	lock, err := lockRepo(repo)
+	rtest.OK(t, err)
+	err = runUnlock(UnlockOptions{RemoveAll: true}, gopts)
+	rtest.Assert(t, err != nil, "locks were removed with a restore-only key")
+	listOpts := env.gopts
+	listOpts.NoLock = true
+	rtest.Equals(t, 1, len(testRunList(t, "locks", listOpts)))
+	unlockRepo(lock)
+
+	rtest.Equals(t, snapshotIDs, testRunList(t, "snapshots", env.gopts))
+	rtest.Equals(t, 1, len(testRunKeyListOtherIDs(t, env.gopts)))
+	testRunCheck(t, env.gopts)
+}
+
 func testFileSize(filename string, size int64) error {
 	fi, err := os.Stat(filename)
 	if err != nil {
@@ -986,6 +1106,254 @@ func TestFindJSON(t *testing.T) {
 	rtest.Assert(t, matches[0].Hits == 3, "expected hits to show 3 matches (%v)", datafile)
 }
 
+func TestFindPredicates(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testRunInit(t, env.gopts)
+
+	dir := filepath.Join(env.testdata, "logs")
+	rtest.OK(t, os.MkdirAll(dir, 0755))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "small.log"), rtest.Random(1, 100), 0644))
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "big.log"), rtest.Random(2, 200*1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, os.Remove(filepath.Join(dir, "big.log")))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	rtest.OK(t, ioutil.WriteFile(filepath.Join(dir, "big.log"), rtest.Random(3, 300*1024), 0644))
+	testRunBackup(t, "", []string{env.testdata}, BackupOptions{}, env.gopts)
+
+	_, snapmap := testRunSnapshots(t, env.gopts)
+	rtest.Equals(t, 3, len(snapmap))
+
+	snapshotTime := func(id string) time.Time {
+		sid, err := restic.ParseID(id)
+		rtest.OK(t, err)
+		return snapmap[sid].Time
+	}
+
+	find := func(opts FindOptions, patterns ...string) []testMatches {
+		var matches []testMatches
+		rtest.OK(t, json.Unmarshal(testRunFindOptions(t, true, env.gopts, opts, patterns...), &matches))
+		return matches
+	}
+
+	paths := func(matches []testMatches) (paths []string) {
+		for _, m := range matches {
+			for _, match := range m.Matches {
+				paths = append(paths, filepath.Base(match.Path))
+			}
+		}
+		sort.Strings(paths)
+		return paths
+	}
+
+	var tests = []struct {
+		opts     FindOptions
+		patterns []string
+		want     []string
+	}{
+		{FindOptions{Type: "d"}, []string{"*.log"}, nil},
+		{FindOptions{Type: "d"}, []string{"logs"}, []string{"logs", "logs", "logs"}},
+		{FindOptions{Type: "f"}, []string{"*.log"}, []string{"big.log", "big.log", "small.log", "small.log", "small.log"}},
+		{FindOptions{Size: "+100K"}, []string{"*.log"}, []string{"big.log", "big.log"}},
+		{FindOptions{Size: "-1K", Type: "f"}, nil, []string{"small.log", "small.log", "small.log"}},
+		{FindOptions{Size: "100"}, nil, []string{"small.log", "small.log", "small.log"}},
+		{FindOptions{Owner: "nonexisting-user"}, []string{"*.log"}, nil},
+	}
+
+	if runtime.GOOS != "windows" {
+		tests = append(tests, struct {
+			opts     FindOptions
+			patterns []string
+			want     []string
+		}{FindOptions{Owner: strconv.Itoa(os.Getuid()), Type: "f"}, nil, []string{"big.log", "big.log", "small.log", "small.log", "small.log"}})
+	}
+
+	for _, test := range tests {
+		rtest.Equals(t, test.want, paths(find(test.opts, test.patterns...)))
+	}
+
+	// the big file is contained in the first and third snapshot
+	oldest := find(FindOptions{Size: "+100K", OldestSnapshot: true})
+	rtest.Equals(t, 1, len(oldest))
+	newest := find(FindOptions{Size: "+100K", NewestSnapshot: true})
+	rtest.Equals(t, 1, len(newest))
+
+	rtest.Assert(t, snapshotTime(oldest[0].SnapshotID).Before(snapshotTime(newest[0].SnapshotID)),
+		"snapshot %v is not older than %v", oldest[0].SnapshotID, newest[0].SnapshotID)
+	rtest.Equals(t, uint64(200*1024), oldest[0].Matches[0].Size)
+	rtest.Equals(t, uint64(300*1024), newest[0].Matches[0].Size)
+
+	for _, opts := range []FindOptions{
+		{Size: "100X"},
+		{Type: "x"},
+		{OldestSnapshot: true, NewestSnapshot: true},
+		{BlobID: true, Size: "+1"},
+	} {
+		err := runFind(opts, env.gopts, []string{"*"})
+		rtest.Assert(t, err != nil, "invalid options %+v were accepted", opts)
+	}
+}
+
+func TestStatsCache(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	opts := BackupOptions{}
+
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+	rtest.OK(t, appendRandomData(filepath.Join(env.testdata, "0", "0", "9", "0"), 1<<20))
+	testRunBackup(t, "", []string{env.testdata}, opts, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	repoIDs, err := ioutil.ReadDir(env.cache)
+	rtest.OK(t, err)
+	var statsDir string
+	for _, fi := range repoIDs {
+		if fi.IsDir() {
+			statsDir = filepath.Join(env.cache, fi.Name(), "stats")
+		}
+	}
+
+	noCache := env.gopts
+	noCache.NoCache = true
+
+	modes := []string{countModeRestoreSize, countModeUniqueFilesByContents, countModeRawData, countModeBlobsPerFile}
+	cachedModes := modes[:2]
+	for _, mode := range modes {
+		want := testRunStats(t, noCache, mode)
+
+		// the first run fills the cache, the second one uses it
+		for i := 0; i < 2; i++ {
+			got := testRunStats(t, env.gopts, mode)
+			rtest.Equals(t, want, got)
+		}
+
+		entries, err := ioutil.ReadDir(filepath.Join(statsDir, mode))
+		if mode == countModeBlobsPerFile || mode == countModeRawData {
+			rtest.Assert(t, os.IsNotExist(err), "stats for %v were cached", mode)
+			continue
+		}
+		rtest.OK(t, err)
+		rtest.Assert(t, len(entries) == 2, "expected stats for two snapshots in the cache for %v, got %d", mode, len(entries))
+	}
+
+	// stats of removed snapshots are removed from the cache
+	testRunForget(t, env.gopts, snapshotIDs[0].String())
+	for _, mode := range cachedModes {
+		want := testRunStats(t, noCache, mode)
+		got := testRunStats(t, env.gopts, mode)
+		rtest.Equals(t, want, got)
+
+		entries, err := ioutil.ReadDir(filepath.Join(statsDir, mode))
+		rtest.OK(t, err)
+		rtest.Assert(t, len(entries) == 1, "expected stats for one snapshot in the cache for %v, got %d", mode, len(entries))
+		rtest.Equals(t, snapshotIDs[1].String(), entries[0].Name())
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	testBundlePassword = "bundle secret"
+	defer func() {
+		testBundlePassword = ""
+	}()
+
+	datafile := filepath.Join("testdata", "backup-data.tar.gz")
+	testRunInit(t, env.gopts)
+	rtest.SetupTarTestFixture(t, env.testdata, datafile)
+
+	testRunBackup(t, filepath.Dir(env.testdata), []string{"testdata"}, BackupOptions{}, env.gopts)
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) == 1, "expected one snapshot, got %v", snapshotIDs)
+
+	bundleFile := filepath.Join(env.base, "snapshot.bundle")
+	rtest.OK(t, runExport(ExportOptions{}, env.gopts, []string{"latest", bundleFile}))
+
+	// refuse to overwrite an existing file
+	err := runExport(ExportOptions{}, env.gopts, []string{"latest", bundleFile})
+	rtest.Assert(t, err != nil, "existing bundle was overwritten")
+
+	// import into a new repository with a different password
+	gopts2 := env.gopts
+	gopts2.Repo = filepath.Join(env.base, "repo2")
+	gopts2.password = "other password"
+	testRunInit(t, gopts2)
+
+	for i := 0; i < 2; i++ {
+		rtest.OK(t, runImport(ImportOptions{}, gopts2, []string{bundleFile}))
+	}
+
+	snapshotIDs = testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+	testRunCheck(t, gopts2)
+
+	restoredir := filepath.Join(env.base, "restore")
+	testRunRestore(t, gopts2, restoredir, snapshotIDs[0])
+	rtest.Assert(t, directoriesEqualContents(env.testdata, filepath.Join(restoredir, "testdata")),
+		"directories are not equal")
+
+	// a wrong password is rejected
+	testBundlePassword = "wrong"
+	err = runImport(ImportOptions{}, gopts2, []string{bundleFile})
+	rtest.Assert(t, err != nil, "bundle was imported with wrong password")
+
+	// truncated bundles are rejected without adding a snapshot
+	buf, err := ioutil.ReadFile(bundleFile)
+	rtest.OK(t, err)
+	rtest.OK(t, ioutil.WriteFile(bundleFile+".truncated", buf[:len(buf)-100], 0600))
+
+	testBundlePassword = "bundle secret"
+	err = runImport(ImportOptions{}, gopts2, []string{bundleFile + ".truncated"})
+	rtest.Assert(t, err != nil, "truncated bundle was imported")
+
+	snapshotIDs = testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(snapshotIDs) == 2, "expected two snapshots, got %v", snapshotIDs)
+
+	// export to stdout and import from stdin, messages must not end up in
+	// the bundle
+	stdoutBundle := filepath.Join(env.base, "stdout.bundle")
+	f, err := os.Create(stdoutBundle)
+	rtest.OK(t, err)
+
+	stdout, verbosity := globalOptions.stdout, globalOptions.verbosity
+	globalOptions.stdout, globalOptions.verbosity = f, 2
+	err = runExport(ExportOptions{}, env.gopts, []string{"latest", "-"})
+	globalOptions.stdout, globalOptions.verbosity = stdout, verbosity
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	f, err = os.Open(stdoutBundle)
+	rtest.OK(t, err)
+	defer f.Close()
+
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() {
+		os.Stdin = stdin
+	}()
+
+	// the repository password cannot be read from stdin
+	gopts3 := gopts2
+	gopts3.password = ""
+	err = runImport(ImportOptions{}, gopts3, []string{"-"})
+	rtest.Assert(t, err != nil, "bundle was imported from stdin without repository password")
+
+	rtest.OK(t, runImport(ImportOptions{}, gopts2, []string{"-"}))
+	snapshotIDs = testRunList(t, "snapshots", gopts2)
+	rtest.Assert(t, len(snapshotIDs) == 3, "expected three snapshots, got %v", snapshotIDs)
+}
+
 func TestRebuildIndex(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -1050,6 +1418,56 @@ func TestCheckRestoreNoLock(t *testing.T) {
 	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
 }
 
+func TestCheckSalvage(t *testing.T) {
+	env, cleanup := withTestEnvironment(t)
+	defer cleanup()
+
+	datafile := filepath.Join("testdata", "small-repo.tar.gz")
+	rtest.SetupTarTestFixture(t, env.base, datafile)
+
+	// append garbage to a pack, which invalidates the pack ID and header but
+	// leaves all blobs intact
+	packs := testRunList(t, "packs", env.gopts)
+	rtest.Assert(t, len(packs) > 0, "no packs found")
+	damaged := packs[0]
+	packfile := filepath.Join(env.repo, "data", damaged.String()[:2], damaged.String())
+
+	f, err := os.OpenFile(packfile, os.O_WRONLY|os.O_APPEND, 0)
+	rtest.OK(t, err)
+	_, err = f.Write([]byte("garbage"))
+	rtest.OK(t, err)
+	rtest.OK(t, f.Close())
+
+	want, err := ioutil.ReadFile(packfile)
+	rtest.OK(t, err)
+
+	quarantine := filepath.Join(env.base, "quarantine")
+	opts := CheckOptions{
+		ReadData:       true,
+		ReadDataMemory: 64,
+		Salvage:        true,
+		QuarantineDir:  quarantine,
+	}
+	rtest.OK(t, checkFlags(opts))
+	err = runCheck(opts, env.gopts, nil)
+	rtest.Assert(t, err != nil, "check did not report the damaged pack")
+
+	got, err := ioutil.ReadFile(filepath.Join(quarantine, damaged.String()))
+	rtest.OK(t, err)
+	rtest.Assert(t, bytes.Equal(want, got), "quarantined pack has wrong content")
+
+	for _, id := range testRunList(t, "packs", env.gopts) {
+		rtest.Assert(t, !id.Equal(damaged), "damaged pack %v is still in the repository", damaged.Str())
+	}
+
+	// all blobs were salvaged, so the repository is intact again
+	testRunCheck(t, env.gopts)
+
+	snapshotIDs := testRunList(t, "snapshots", env.gopts)
+	rtest.Assert(t, len(snapshotIDs) > 0, "found no snapshots")
+	testRunRestore(t, env.gopts, filepath.Join(env.base, "restore"), snapshotIDs[0])
+}
+
 func TestPrune(t *testing.T) {
 	env, cleanup := withTestEnvironment(t)
 	defer cleanup()
@@ -29,6 +29,10 @@ func lockRepoExclusive(repo *repository.Repository) (*restic.Lock, error) {
 }
 
 func lockRepository(repo *repository.Repository, exclusive bool) (*restic.Lock, error) {
+	if exclusive && repo.ReadOnly() {
+		return nil, errors.Fatal("unable to create exclusive lock: the repository was opened with a restore-only key")
+	}
+
 	lockFn := restic.NewLock
 	if exclusive {
 		lockFn = restic.NewExclusiveLock
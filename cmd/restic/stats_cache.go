@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+
+	"github.com/restic/restic/internal/cache"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/walker"
+)
+
+// snapshotStats are the statistics of a single snapshot, which are kept in
+// the local cache. They contain enough information to combine the statistics
+// of several snapshots without walking their trees again. Depending on the
+// counting mode, only some of the fields are used.
+type snapshotStats struct {
+	// totals for restore-size
+	TotalSize      uint64
+	TotalFileCount uint64
+
+	// files with unique contents in the snapshot, for files-by-contents
+	Files []statsFile
+}
+
+type statsFile struct {
+	ID   fileID
+	Size uint64
+}
+
+// statsCacheVersion is the version of the encoding of snapshotStats, it is
+// increased whenever the encoding changes.
+const statsCacheVersion = 2
+
+// statsCache stores the statistics for snapshots in the local cache. The data
+// is encrypted with the repository key, as the blob IDs reveal information
+// about the contents of the snapshots.
+type statsCache struct {
+	cache *cache.Cache
+	key   *crypto.Key
+	mode  string
+}
+
+// newStatsCache returns a stats cache for the counting mode, or nil if the
+// repository does not use a local cache. The statistics for blobs-per-file
+// depend on which files have been seen in other snapshots, so they are
+// not cached. For raw-data, the set of all blobs referenced by each snapshot
+// would need to be stored, so it is not cached either.
+func newStatsCache(repo *repository.Repository, mode string) *statsCache {
+	c, ok := repo.Cache.(*cache.Cache)
+	if !ok || c == nil || mode == countModeBlobsPerFile || mode == countModeRawData {
+		return nil
+	}
+
+	return &statsCache{cache: c, key: repo.Key(), mode: mode}
+}
+
+// Load returns the cached statistics for the snapshot id. If nothing is
+// cached for the snapshot, nil is returned.
+func (c *statsCache) Load(id restic.ID) (*snapshotStats, error) {
+	buf, err := c.cache.LoadStats(c.mode, id)
+	if c.cache.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < c.key.NonceSize() {
+		return nil, errors.New("cached stats are truncated")
+	}
+
+	nonce, ciphertext := buf[:c.key.NonceSize()], buf[c.key.NonceSize():]
+	plaintext, err := c.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshotStats(plaintext)
+}
+
+// Save stores the statistics for the snapshot id.
+func (c *statsCache) Save(id restic.ID, stats *snapshotStats) error {
+	plaintext := stats.encode()
+
+	nonce := crypto.NewRandomNonce()
+	ciphertext := make([]byte, 0, len(nonce)+len(plaintext)+c.key.Overhead())
+	ciphertext = append(ciphertext, nonce...)
+	ciphertext = c.key.Seal(ciphertext, nonce, plaintext, nil)
+
+	return c.cache.SaveStats(c.mode, id, ciphertext)
+}
+
+// encode returns the binary representation of stats: a version byte and the
+// totals, followed by the list of files (ID and size) prefixed with the number
+// of items.
+func (stats *snapshotStats) encode() []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 1+3*8+len(stats.Files)*40))
+	var tmp [8]byte
+
+	putUint64 := func(v uint64) {
+		binary.LittleEndian.PutUint64(tmp[:], v)
+		buf.Write(tmp[:])
+	}
+
+	buf.WriteByte(statsCacheVersion)
+	putUint64(stats.TotalSize)
+	putUint64(stats.TotalFileCount)
+
+	putUint64(uint64(len(stats.Files)))
+	for _, f := range stats.Files {
+		buf.Write(f.ID[:])
+		putUint64(f.Size)
+	}
+
+	return buf.Bytes()
+}
+
+func decodeSnapshotStats(buf []byte) (*snapshotStats, error) {
+	errInvalid := errors.New("invalid cached stats")
+
+	if len(buf) < 1 || buf[0] != statsCacheVersion {
+		return nil, errInvalid
+	}
+	buf = buf[1:]
+
+	getUint64 := func() (uint64, bool) {
+		if len(buf) < 8 {
+			return 0, false
+		}
+		v := binary.LittleEndian.Uint64(buf)
+		buf = buf[8:]
+		return v, true
+	}
+
+	stats := &snapshotStats{}
+	var ok bool
+
+	if stats.TotalSize, ok = getUint64(); !ok {
+		return nil, errInvalid
+	}
+	if stats.TotalFileCount, ok = getUint64(); !ok {
+		return nil, errInvalid
+	}
+
+	n, ok := getUint64()
+	if !ok || n != uint64(len(buf)/40) || len(buf)%40 != 0 {
+		return nil, errInvalid
+	}
+	if n > 0 {
+		stats.Files = make([]statsFile, n)
+	}
+	for i := range stats.Files {
+		copy(stats.Files[i].ID[:], buf[:32])
+		buf = buf[32:]
+		stats.Files[i].Size, _ = getUint64()
+	}
+
+	return stats, nil
+}
+
+// computeSnapshotStats walks the snapshot and collects the statistics which
+// are needed for the counting mode.
+func computeSnapshotStats(ctx context.Context, repo restic.Repository, snapshot *restic.Snapshot, mode string) (*snapshotStats, error) {
+	if snapshot.Tree == nil {
+		return nil, errors.Errorf("snapshot %s has nil tree", snapshot.ID().Str())
+	}
+
+	stats := &snapshotStats{}
+
+	switch mode {
+	case countModeUniqueFilesByContents:
+		files := make(map[fileID]struct{})
+		err := walker.Walk(ctx, repo, *snapshot.Tree, restic.NewIDSet(), func(_ restic.ID, _ string, node *restic.Node, nodeErr error) (bool, error) {
+			if nodeErr != nil {
+				return true, nodeErr
+			}
+			if node == nil {
+				return true, nil
+			}
+
+			fid := makeFileIDByContents(node)
+			if _, ok := files[fid]; !ok {
+				files[fid] = struct{}{}
+				stats.Files = append(stats.Files, statsFile{ID: fid, Size: node.Size})
+			}
+			return true, nil
+		})
+		if err != nil {
+			return nil, errors.Errorf("walking tree %s: %v", *snapshot.Tree, err)
+		}
+
+		return stats, nil
+
+	case countModeRestoreSize:
+		err := walker.Walk(ctx, repo, *snapshot.Tree, restic.NewIDSet(), func(_ restic.ID, _ string, node *restic.Node, nodeErr error) (bool, error) {
+			if nodeErr != nil {
+				return true, nodeErr
+			}
+			if node == nil {
+				return true, nil
+			}
+
+			stats.TotalSize += node.Size
+			stats.TotalFileCount++
+			return true, nil
+		})
+		if err != nil {
+			return nil, errors.Errorf("walking tree %s: %v", *snapshot.Tree, err)
+		}
+
+		return stats, nil
+	}
+
+	return nil, errors.Errorf("counting mode %v cannot be cached", mode)
+}
+
+// add merges the statistics of a single snapshot into the container.
+func (s *statsContainer) add(stats *snapshotStats) {
+	s.TotalSize += stats.TotalSize
+	s.TotalFileCount += stats.TotalFileCount
+
+	for _, f := range stats.Files {
+		if _, ok := s.uniqueFiles[f.ID]; ok {
+			continue
+		}
+		s.uniqueFiles[f.ID] = struct{}{}
+		s.TotalSize += f.Size
+		s.TotalFileCount++
+	}
+}
+
+// statsSnapshot adds the statistics for the snapshot id to stats. If sc is
+// not nil, cached statistics are used and missing ones are saved to the
+// cache.
+func statsSnapshot(ctx context.Context, repo restic.Repository, sc *statsCache, id restic.ID, snapshot *restic.Snapshot, stats *statsContainer) error {
+	if sc == nil {
+		return statsWalkSnapshot(ctx, snapshot, repo, stats)
+	}
+
+	snStats, err := sc.Load(id)
+	if err != nil {
+		// the cache is only an optimization, compute the stats again
+		debug.Log("unable to load cached stats for %v: %v", id.Str(), err)
+		snStats = nil
+	}
+
+	if snStats == nil {
+		snStats, err = computeSnapshotStats(ctx, repo, snapshot, sc.mode)
+		if err != nil {
+			return err
+		}
+
+		err = sc.Save(id, snStats)
+		if err != nil {
+			Warnf("unable to save stats for snapshot %v in the cache: %v\n", id.Str(), err)
+		}
+	}
+
+	stats.add(snStats)
+	return nil
+}
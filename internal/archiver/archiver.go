@@ -56,6 +56,7 @@ type Archiver struct {
 	blobSaver *BlobSaver
 	fileSaver *FileSaver
 	treeSaver *TreeSaver
+	dirReader *dirReader
 
 	// Error is called for all errors that occur during backup.
 	Error ErrorFunc
@@ -80,6 +81,12 @@ type Archiver struct {
 	// default.
 	WithAtime   bool
 	IgnoreInode bool
+
+	// FollowTargetSymlinks configures if symbolic links which are passed as
+	// targets are followed, so that the file or directory they point to is
+	// saved under the name of the link. Symbolic links within directories are
+	// always saved as links.
+	FollowTargetSymlinks bool
 }
 
 // Options is used to configure the archiver.
@@ -97,6 +104,11 @@ type Options struct {
 	// SaveTreeConcurrency sets how many trees are marshalled and saved to the
 	// repo concurrently.
 	SaveTreeConcurrency uint
+
+	// ReadDirConcurrency sets how many directories are read concurrently
+	// while walking the targets. The trees are still assembled in a
+	// deterministic order.
+	ReadDirConcurrency uint
 }
 
 // ApplyDefaults returns a copy of o with the default options set for all unset
@@ -119,6 +131,10 @@ func (o Options) ApplyDefaults() Options {
 		o.SaveTreeConcurrency = o.SaveBlobConcurrency * 20
 	}
 
+	if o.ReadDirConcurrency == 0 {
+		o.ReadDirConcurrency = defaultReadDirConcurrency
+	}
+
 	return o
 }
 
@@ -209,6 +225,13 @@ func (arch *Archiver) loadSubtree(ctx context.Context, node *restic.Node) *resti
 // SaveDir stores a directory in the repo and returns the node. snPath is the
 // path within the current snapshot.
 func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo, dir string, previous *restic.Tree) (d FutureTree, err error) {
+	return arch.saveDir(ctx, snPath, fi, dir, "", previous, nil)
+}
+
+// saveDir stores a directory in the repo. The entries are passed to the select
+// functions with paths below absdir, if it is set. If the directory has
+// already been read in the background, f must be set.
+func (arch *Archiver) saveDir(ctx context.Context, snPath string, fi os.FileInfo, dir, absdir string, previous *restic.Tree, f *futureDir) (d FutureTree, err error) {
 	debug.Log("%v %v", snPath, dir)
 
 	treeNode, err := arch.nodeFromFileInfo(dir, fi)
@@ -216,28 +239,33 @@ func (arch *Archiver) SaveDir(ctx context.Context, snPath string, fi os.FileInfo
 		return FutureTree{}, err
 	}
 
-	names, err := readdirnames(arch.FS, dir)
+	entries, err := arch.dirReader.read(ctx, dir, absdir, f)
 	if err != nil {
 		return FutureTree{}, err
 	}
 
-	nodes := make([]FutureNode, 0, len(names))
+	nodes := make([]FutureNode, 0, len(entries))
 
-	for _, name := range names {
+	// subdirectories are read in the background while the entries are
+	// processed in order
+	ra := arch.dirReader.readAhead(entries)
+	for i := range entries {
 		// test if context has been cancelled
 		if ctx.Err() != nil {
 			debug.Log("context has been cancelled, aborting")
 			return FutureTree{}, ctx.Err()
 		}
 
-		pathname := arch.FS.Join(dir, name)
-		oldNode := previous.Find(name)
-		snItem := join(snPath, name)
-		fn, excluded, err := arch.Save(ctx, snItem, pathname, oldNode)
+		ra.advance(ctx, i)
+		e := entries[i]
+
+		oldNode := previous.Find(e.name)
+		snItem := join(snPath, e.name)
+		fn, excluded, err := arch.save(ctx, snItem, e, oldNode)
 
 		// return error early if possible
 		if err != nil {
-			err = arch.error(pathname, fi, err)
+			err = arch.error(e.path, fi, err)
 			if err == nil {
 				// ignore error
 				continue
@@ -309,7 +337,39 @@ func (fn *FutureNode) wait(ctx context.Context) {
 //
 // snPath is the path within the current snapshot.
 func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous *restic.Node) (fn FutureNode, excluded bool, err error) {
+	e := dirEntry{path: target}
+	arch.dirReader.load(&e)
+
+	if arch.FollowTargetSymlinks && e.selectedByName && e.err == nil && e.fi.Mode()&os.ModeSymlink != 0 {
+		e = arch.followSymlink(e)
+	}
+
+	return arch.save(ctx, snPath, e, previous)
+}
+
+// followSymlink returns the entry for the file or directory the symbolic link
+// e points to. The entry is read from the resolved path, but the select
+// functions still see the path of the link. Errors are returned in the entry,
+// so that they are handled by the error callback.
+func (arch *Archiver) followSymlink(e dirEntry) dirEntry {
+	resolved, err := arch.FS.EvalSymlinks(e.path)
+	if err != nil {
+		debug.Log("unable to follow symlink %v: %v", e.path, err)
+		e.err = err
+		return e
+	}
+
+	debug.Log("following symlink %v to %v", e.path, resolved)
+	re := dirEntry{name: e.name, path: resolved, abspath: e.abspath}
+	arch.dirReader.load(&re)
+	return re
+}
+
+// save saves the item e, for which the select functions and Lstat have
+// already been run.
+func (arch *Archiver) save(ctx context.Context, snPath string, e dirEntry, previous *restic.Node) (fn FutureNode, excluded bool, err error) {
 	start := time.Now()
+	target := e.path
 
 	fn = FutureNode{
 		snPath: snPath,
@@ -317,22 +377,22 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 	}
 
 	debug.Log("%v target %q, previous %v", snPath, target, previous)
-	abstarget, err := arch.FS.Abs(target)
-	if err != nil {
-		return FutureNode{}, false, err
+	if e.absErr != nil {
+		return FutureNode{}, false, e.absErr
 	}
 
+	abstarget := e.abspath
 	fn.absTarget = abstarget
 
 	// exclude files by path before running Lstat to reduce number of lstat calls
-	if !arch.SelectByName(abstarget) {
+	if !e.selectedByName {
 		debug.Log("%v is excluded by path", target)
 		return FutureNode{}, true, nil
 	}
 
-	// get file info and run remaining select functions that require file information
-	fi, err := arch.FS.Lstat(target)
-	if !arch.Select(abstarget, fi) {
+	// remaining select functions that require file information
+	fi, err := e.fi, e.err
+	if !e.selected {
 		debug.Log("%v is excluded", target)
 		return FutureNode{}, true, nil
 	}
@@ -417,7 +477,7 @@ func (arch *Archiver) Save(ctx context.Context, snPath, target string, previous
 		oldSubtree := arch.loadSubtree(ctx, previous)
 
 		fn.isTree = true
-		fn.tree, err = arch.SaveDir(ctx, snPath, fi, target, oldSubtree)
+		fn.tree, err = arch.saveDir(ctx, snPath, fi, target, abstarget, oldSubtree, e.dir)
 		if err == nil {
 			arch.CompleteItem(snItem, previous, fn.node, fn.stats, time.Since(start))
 		} else {
@@ -761,6 +821,11 @@ func (arch *Archiver) runWorkers(ctx context.Context, t *tomb.Tomb) {
 	arch.fileSaver.NodeFromFileInfo = arch.nodeFromFileInfo
 
 	arch.treeSaver = NewTreeSaver(ctx, t, arch.Options.SaveTreeConcurrency, arch.saveTree, arch.Error)
+
+	arch.dirReader = newDirReader(arch.FS,
+		func(item string) bool { return arch.SelectByName(item) },
+		func(item string, fi os.FileInfo) bool { return arch.Select(item, fi) },
+		arch.Options.ReadDirConcurrency)
 }
 
 // Snapshot saves several targets and returns a snapshot.
@@ -1382,6 +1382,186 @@ func TestArchiverSnapshot(t *testing.T) {
 	}
 }
 
+func TestArchiverSnapshotFollowSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks are not created on Windows")
+	}
+
+	var tests = []struct {
+		name    string
+		src     TestDir
+		want    TestDir
+		follow  bool
+		targets []string
+		err     bool
+	}{
+		{
+			name: "dir-link",
+			src: TestDir{
+				"srv": TestDir{
+					"site": TestDir{
+						"index.html": TestFile{Content: "index"},
+						"link":       TestSymlink{Target: "index.html"},
+					},
+				},
+				"www": TestSymlink{Target: "srv/site"},
+			},
+			targets: []string{"www"},
+			follow:  true,
+			want: TestDir{
+				"www": TestDir{
+					"index.html": TestFile{Content: "index"},
+					"link":       TestSymlink{Target: "index.html"},
+				},
+			},
+		},
+		{
+			name: "dir-link-not-followed",
+			src: TestDir{
+				"srv": TestDir{
+					"site": TestDir{
+						"index.html": TestFile{Content: "index"},
+					},
+				},
+				"www": TestSymlink{Target: "srv/site"},
+			},
+			targets: []string{"www"},
+			want: TestDir{
+				"www": TestSymlink{Target: "srv/site"},
+			},
+		},
+		{
+			name: "file-link",
+			src: TestDir{
+				"file": TestFile{Content: "content"},
+				"link": TestSymlink{Target: "file"},
+			},
+			targets: []string{"link"},
+			follow:  true,
+			want: TestDir{
+				"link": TestFile{Content: "content"},
+			},
+		},
+		{
+			name: "link-chain",
+			src: TestDir{
+				"dir": TestDir{
+					"file": TestFile{Content: "content"},
+				},
+				"link1": TestSymlink{Target: "dir"},
+				"link2": TestSymlink{Target: "link1"},
+			},
+			targets: []string{"link2"},
+			follow:  true,
+			want: TestDir{
+				"link2": TestDir{
+					"file": TestFile{Content: "content"},
+				},
+			},
+		},
+		{
+			name: "dangling-link",
+			src: TestDir{
+				"link": TestSymlink{Target: "missing"},
+			},
+			targets: []string{"link"},
+			follow:  true,
+			err:     true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			tempdir, repo, cleanup := prepareTempdirRepoSrc(t, test.src)
+			defer cleanup()
+
+			arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+			arch.FollowTargetSymlinks = test.follow
+
+			back := fs.TestChdir(t, tempdir)
+			defer back()
+
+			_, snapshotID, err := arch.Snapshot(ctx, test.targets, SnapshotOptions{Time: time.Now()})
+			if test.err {
+				if err == nil {
+					t.Fatal("expected error not found")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			TestEnsureSnapshot(t, repo, snapshotID, test.want)
+			checker.TestCheckRepo(t, repo)
+		})
+	}
+}
+
+func TestArchiverFollowSymlinksSelectPaths(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	src := TestDir{
+		"srv": TestDir{
+			"site": TestDir{
+				"index.html": TestFile{Content: "index"},
+				"tmp": TestDir{
+					"cache": TestFile{Content: "cache"},
+				},
+			},
+		},
+		"www": TestSymlink{Target: "srv/site"},
+	}
+
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, src)
+	defer cleanup()
+
+	arch := New(repo, fs.Track{FS: fs.Local{}}, Options{})
+	arch.FollowTargetSymlinks = true
+
+	// the select functions must see the paths below the link, not the
+	// resolved paths
+	link := filepath.Join(tempdir, "www")
+	var m sync.Mutex
+	var items []string
+	arch.SelectByName = func(item string) bool {
+		m.Lock()
+		items = append(items, item)
+		m.Unlock()
+		return item != filepath.Join(link, "tmp")
+	}
+	arch.Select = func(item string, fi os.FileInfo) bool {
+		if !fs.HasPathPrefix(link, item) {
+			t.Errorf("Select called with %v, which is not below %v", item, link)
+		}
+		return true
+	}
+
+	back := fs.TestChdir(t, tempdir)
+	defer back()
+
+	_, snapshotID, err := arch.Snapshot(ctx, []string{"www"}, SnapshotOptions{Time: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, item := range items {
+		if !fs.HasPathPrefix(link, item) {
+			t.Errorf("SelectByName called with %v, which is not below %v", item, link)
+		}
+	}
+
+	TestEnsureSnapshot(t, repo, snapshotID, TestDir{
+		"www": TestDir{
+			"index.html": TestFile{Content: "index"},
+		},
+	})
+}
+
 func TestArchiverSnapshotSelect(t *testing.T) {
 	var tests = []struct {
 		name  string
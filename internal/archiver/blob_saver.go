@@ -19,6 +19,10 @@ type Saver interface {
 type BlobSaver struct {
 	repo Saver
 
+	// index contains the blobs which were stored in the repo when the
+	// BlobSaver was created
+	index *knownBlobs
+
 	m          sync.Mutex
 	knownBlobs restic.BlobSet
 
@@ -27,7 +31,9 @@ type BlobSaver struct {
 }
 
 // NewBlobSaver returns a new blob. A worker pool is started, it is stopped
-// when ctx is cancelled.
+// when ctx is cancelled. The blobs contained in the index of the repo are
+// recorded in a lock-free table first, so the index should be loaded before.
+// If the index cannot be read, t is killed with the error.
 func NewBlobSaver(ctx context.Context, t *tomb.Tomb, repo Saver, workers uint) *BlobSaver {
 	ch := make(chan saveBlobJob)
 	s := &BlobSaver{
@@ -37,6 +43,15 @@ func NewBlobSaver(ctx context.Context, t *tomb.Tomb, repo Saver, workers uint) *
 		done:       t.Dying(),
 	}
 
+	index, err := newKnownBlobs(ctx, repo.Index())
+	if err != nil {
+		debug.Log("unable to read the index: %v", err)
+		s.index = &knownBlobs{}
+		t.Kill(err)
+	} else {
+		s.index = index
+	}
+
 	for i := uint(0); i < workers; i++ {
 		t.Go(func() error {
 			return s.worker(t.Context(ctx), ch)
@@ -115,6 +130,15 @@ func (s *BlobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte)
 	id := restic.Hash(buf)
 	h := restic.BlobHandle{ID: id, Type: t}
 
+	// check if the blob was already stored when the backup started, this
+	// does not need any locks
+	if s.index.Has(h) {
+		return saveBlobResponse{
+			id:    id,
+			known: true,
+		}, nil
+	}
+
 	// check if another goroutine has already saved this blob
 	known := false
 	s.m.Lock()
@@ -141,6 +165,9 @@ func (s *BlobSaver) saveBlob(ctx context.Context, t restic.BlobType, buf []byte)
 			known: true,
 		}, nil
 	}
+	if err := s.repo.Index().Err(); err != nil {
+		return saveBlobResponse{}, err
+	}
 
 	// otherwise we're responsible for saving it
 	_, err := s.repo.SaveBlob(ctx, t, buf, id)
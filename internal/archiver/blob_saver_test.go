@@ -113,3 +113,51 @@ func TestBlobSaverError(t *testing.T) {
 		})
 	}
 }
+
+func TestBlobSaverKnownBlobs(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idx := repository.NewIndex()
+	for i := 0; i < 10; i++ {
+		idx.Store(restic.PackedBlob{
+			Blob: restic.Blob{
+				Type: restic.DataBlob,
+				ID:   restic.Hash([]byte(fmt.Sprintf("foo%d", i))),
+			},
+			PackID: restic.NewRandomID(),
+		})
+	}
+
+	var tmb tomb.Tomb
+	saver := &saveFail{
+		idx: idx,
+	}
+
+	b := NewBlobSaver(ctx, &tmb, saver, uint(runtime.NumCPU()))
+
+	var results []FutureBlob
+	for i := 0; i < 20; i++ {
+		buf := &Buffer{Data: []byte(fmt.Sprintf("foo%d", i))}
+		fb := b.Save(ctx, restic.DataBlob, buf)
+		results = append(results, fb)
+	}
+
+	for i, blob := range results {
+		blob.Wait(ctx)
+		if blob.Known() != (i < 10) {
+			t.Errorf("blob %v: wrong value for known, want %v, got %v", i, i < 10, blob.Known())
+		}
+	}
+
+	if atomic.LoadInt32(&saver.cnt) != 10 {
+		t.Errorf("wrong number of blobs saved, want 10, got %d", saver.cnt)
+	}
+
+	tmb.Kill(nil)
+
+	err := tmb.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,220 @@
+package archiver
+
+import (
+	"context"
+	"os"
+
+	"github.com/restic/restic/internal/fs"
+)
+
+// defaultReadDirConcurrency is the number of directories read concurrently
+// if not configured otherwise. Reading directories is mostly waiting for the
+// file system, which takes long on network file systems.
+const defaultReadDirConcurrency = 8
+
+// dirEntry is an entry of a directory together with the information needed to
+// decide whether it is included. The entry is read from path, while the select
+// functions are called with abspath. Both only differ below a symbolic link
+// which was followed, abspath is then still in terms of the link.
+type dirEntry struct {
+	name string
+	path string
+
+	// abspath is computed from path when the entry is loaded, unless it is
+	// already set
+	abspath string
+
+	// the remaining fields are only valid when loaded is set
+	loaded bool
+	absErr error
+
+	// selectedByName is the result of SelectByName for abspath, Lstat is
+	// only run for entries which are selected by name
+	selectedByName bool
+	fi             os.FileInfo
+	err            error
+
+	// selected is the result of Select, which is also called if Lstat
+	// returned an error
+	selected bool
+
+	// contents of the directory, if it is read in the background
+	dir *futureDir
+}
+
+// isDir returns true if the entry is a directory which is included.
+func (e *dirEntry) isDir() bool {
+	return e.loaded && e.absErr == nil && e.selectedByName && e.err == nil && e.selected && e.fi.IsDir()
+}
+
+// futureDir is the list of entries of a directory which is read in the
+// background.
+type futureDir struct {
+	done    chan struct{}
+	entries []dirEntry
+	err     error
+}
+
+// wait blocks until the directory has been read or ctx is cancelled.
+func (f *futureDir) wait(ctx context.Context) ([]dirEntry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-f.done:
+		return f.entries, f.err
+	}
+}
+
+// dirReader lists directories and runs Lstat and the select functions on the
+// entries. While the entries of a directory are processed in order, the
+// subdirectories are read in the background by a bounded number of
+// goroutines, so the file system is accessed concurrently while the results
+// are still consumed in a deterministic order. The select functions are
+// called concurrently.
+type dirReader struct {
+	fs           fs.FS
+	selectByName SelectByNameFunc
+	selectFn     SelectFunc
+
+	// sem limits the number of directories read concurrently
+	sem chan struct{}
+}
+
+func newDirReader(filesystem fs.FS, selectByName SelectByNameFunc, selectFn SelectFunc, concurrency uint) *dirReader {
+	if concurrency == 0 {
+		concurrency = defaultReadDirConcurrency
+	}
+
+	return &dirReader{
+		fs:           filesystem,
+		selectByName: selectByName,
+		selectFn:     selectFn,
+		sem:          make(chan struct{}, concurrency),
+	}
+}
+
+// read returns the entries of dir, sorted by name. The absolute paths of the
+// entries are based on absdir if it is not empty. If f is not nil, the result
+// of reading the directory in the background is returned instead. The entries
+// must be passed to load before they are used.
+func (r *dirReader) read(ctx context.Context, dir, absdir string, f *futureDir) ([]dirEntry, error) {
+	if f != nil {
+		return f.wait(ctx)
+	}
+
+	names, err := readdirnames(r.fs, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]dirEntry, 0, len(names))
+	for _, name := range names {
+		e := dirEntry{
+			name: name,
+			path: r.fs.Join(dir, name),
+		}
+		if absdir != "" {
+			e.abspath = r.fs.Join(absdir, name)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// load collects the information for the entry, unless this has already been
+// done in the background.
+func (r *dirReader) load(e *dirEntry) {
+	if e.loaded {
+		return
+	}
+	e.loaded = true
+
+	if e.abspath == "" {
+		e.abspath, e.absErr = r.fs.Abs(e.path)
+		if e.absErr != nil {
+			return
+		}
+	}
+
+	// exclude files by path before running Lstat to reduce number of lstat calls
+	e.selectedByName = r.selectByName(e.abspath)
+	if !e.selectedByName {
+		return
+	}
+
+	e.fi, e.err = r.fs.Lstat(e.path)
+	e.selected = r.selectFn(e.abspath, e.fi)
+}
+
+// start reads dir in the background.
+func (r *dirReader) start(ctx context.Context, dir, absdir string) *futureDir {
+	f := &futureDir{done: make(chan struct{})}
+
+	go func() {
+		defer close(f.done)
+
+		select {
+		case r.sem <- struct{}{}:
+		case <-ctx.Done():
+			f.err = ctx.Err()
+			return
+		}
+
+		defer func() {
+			<-r.sem
+		}()
+
+		f.entries, f.err = r.read(ctx, dir, absdir, nil)
+		for i := range f.entries {
+			if ctx.Err() != nil {
+				f.entries, f.err = nil, ctx.Err()
+				return
+			}
+			r.load(&f.entries[i])
+		}
+	}()
+
+	return f
+}
+
+// readAhead starts reading the subdirectories of entries in the background,
+// keeping at most as many directories ahead of the current position as
+// directories can be read concurrently.
+type readAhead struct {
+	r       *dirReader
+	entries []dirEntry
+
+	// next entry to check, and the positions of the directories started
+	// ahead of the current position
+	next    int
+	started []int
+}
+
+func (r *dirReader) readAhead(entries []dirEntry) *readAhead {
+	return &readAhead{r: r, entries: entries}
+}
+
+// advance must be called before the entry at position i is processed. It
+// loads the entry and starts reading directories following it.
+func (ra *readAhead) advance(ctx context.Context, i int) {
+	for len(ra.started) > 0 && ra.started[0] < i {
+		ra.started = ra.started[1:]
+	}
+
+	ra.r.load(&ra.entries[i])
+
+	for ra.next < len(ra.entries) && len(ra.started) < cap(ra.r.sem) {
+		e := &ra.entries[ra.next]
+		if ra.next > i && !e.loaded {
+			// only entries up to the current position are loaded, the
+			// others are checked once they are reached
+			break
+		}
+		if e.isDir() {
+			e.dir = ra.r.start(ctx, e.path, e.abspath)
+			ra.started = append(ra.started, ra.next)
+		}
+		ra.next++
+	}
+}
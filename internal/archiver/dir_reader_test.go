@@ -0,0 +1,106 @@
+package archiver
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/restic/restic/internal/fs"
+	restictest "github.com/restic/restic/internal/test"
+)
+
+// testNestedDir returns a tree of directories with depth levels, each
+// directory contains width subdirectories and a file.
+func testNestedDir(depth, width int) TestDir {
+	dir := TestDir{
+		"file": TestFile{Content: fmt.Sprintf("file at depth %d", depth)},
+	}
+
+	if depth == 0 {
+		return dir
+	}
+
+	for i := 0; i < width; i++ {
+		dir[fmt.Sprintf("dir%d", i)] = testNestedDir(depth-1, width)
+	}
+
+	return dir
+}
+
+func TestScannerReadDirConcurrency(t *testing.T) {
+	tempdir, cleanup := restictest.TempDir(t)
+	defer cleanup()
+
+	TestCreateFiles(t, tempdir, testNestedDir(3, 4))
+
+	back := fs.TestChdir(t, tempdir)
+	defer back()
+
+	scan := func(concurrency uint) (items []string, results map[string]ScanStats) {
+		results = make(map[string]ScanStats)
+
+		sc := NewScanner(fs.Track{FS: fs.Local{}})
+		sc.ReadDirConcurrency = concurrency
+		sc.Result = func(item string, s ScanStats) {
+			items = append(items, item)
+			results[item] = s
+		}
+
+		err := sc.Scan(context.Background(), []string{"."})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return items, results
+	}
+
+	wantItems, want := scan(1)
+	total := want[""]
+	if total.Files != 85 || total.Dirs != 85 {
+		t.Fatalf("unexpected total stats %+v", total)
+	}
+
+	for _, concurrency := range []uint{2, 8, 32} {
+		items, results := scan(concurrency)
+		if !cmp.Equal(wantItems, items) {
+			t.Errorf("concurrency %d: order of results differs: %v", concurrency, cmp.Diff(wantItems, items))
+		}
+		if !cmp.Equal(want, results) {
+			t.Errorf("concurrency %d: results differ: %v", concurrency, cmp.Diff(want, results))
+		}
+	}
+}
+
+func TestArchiverReadDirConcurrency(t *testing.T) {
+	tempdir, repo, cleanup := prepareTempdirRepoSrc(t, testNestedDir(3, 4))
+	defer cleanup()
+
+	back := fs.TestChdir(t, tempdir)
+	defer back()
+
+	snapshot := func(concurrency uint) string {
+		arch := New(repo, fs.Track{FS: fs.Local{}}, Options{ReadDirConcurrency: concurrency})
+		arch.Error = func(item string, fi os.FileInfo, err error) error {
+			t.Errorf("archiver error for %v: %v", item, err)
+			return err
+		}
+
+		sn, _, err := arch.Snapshot(context.Background(), []string{"."}, SnapshotOptions{Time: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sn.Tree.String()
+	}
+
+	want := snapshot(1)
+	for _, concurrency := range []uint{2, 8, 32} {
+		got := snapshot(concurrency)
+		if got != want {
+			t.Errorf("concurrency %d: tree %v differs from tree %v", concurrency, got, want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package archiver
+
+import (
+	"bytes"
+	"context"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/restic"
+)
+
+// knownBlobs is a read-only snapshot of the blobs contained in the index when
+// a backup starts. It is a compact sorted table of IDs per blob type, which
+// can be queried concurrently without any locking. This keeps the hot path of
+// the BlobSaver ("is this blob already stored?") from contending on the index
+// lock when many CPU cores are used.
+type knownBlobs struct {
+	data, tree idTable
+}
+
+// idTable is a sorted list of IDs, together with a lookup table for the first
+// byte of the IDs.
+type idTable struct {
+	ids restic.IDs
+
+	// the IDs starting with byte b are at positions fanout[b] to
+	// fanout[b+1]-1
+	fanout [257]int
+}
+
+// newKnownBlobs builds the table from all blobs in idx. An error is returned
+// if the index could not be read completely.
+func newKnownBlobs(ctx context.Context, idx restic.Index) (*knownBlobs, error) {
+	k := &knownBlobs{}
+	if idx == nil {
+		return k, nil
+	}
+
+	k.data.ids = make(restic.IDs, 0, idx.Count(restic.DataBlob))
+	k.tree.ids = make(restic.IDs, 0, idx.Count(restic.TreeBlob))
+
+	for pb := range idx.Each(ctx) {
+		switch pb.Type {
+		case restic.DataBlob:
+			k.data.ids = append(k.data.ids, pb.ID)
+		case restic.TreeBlob:
+			k.tree.ids = append(k.tree.ids, pb.ID)
+		}
+	}
+
+	// with blobs missing from the table, data would be saved again
+	if err := idx.Err(); err != nil {
+		return nil, err
+	}
+
+	k.data.build()
+	k.tree.build()
+
+	debug.Log("%d data and %d tree blobs known", len(k.data.ids), len(k.tree.ids))
+
+	return k, nil
+}
+
+// build sorts the IDs and fills the lookup table.
+func (t *idTable) build() {
+	sort.Sort(t.ids)
+
+	pos := 0
+	for b := 0; b < 256; b++ {
+		t.fanout[b] = pos
+		for pos < len(t.ids) && int(t.ids[pos][0]) == b {
+			pos++
+		}
+	}
+	t.fanout[256] = len(t.ids)
+}
+
+// Has returns true if id is contained in the table.
+func (t *idTable) Has(id restic.ID) bool {
+	lo, hi := t.fanout[id[0]], t.fanout[int(id[0])+1]
+	ids := t.ids[lo:hi]
+
+	i := sort.Search(len(ids), func(i int) bool {
+		return bytes.Compare(ids[i][:], id[:]) >= 0
+	})
+
+	return i < len(ids) && ids[i] == id
+}
+
+// Has returns true if the blob h was contained in the index when the table
+// was built.
+func (k *knownBlobs) Has(h restic.BlobHandle) bool {
+	switch h.Type {
+	case restic.DataBlob:
+		return k.data.Has(h.ID)
+	case restic.TreeBlob:
+		return k.tree.Has(h.ID)
+	}
+
+	return false
+}
@@ -0,0 +1,97 @@
+package archiver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestKnownBlobs(t *testing.T) {
+	idx := repository.NewIndex()
+
+	var data, tree restic.IDs
+	for i := 0; i < 1000; i++ {
+		blob := restic.PackedBlob{
+			Blob: restic.Blob{
+				Type: restic.DataBlob,
+				ID:   restic.NewRandomID(),
+			},
+			PackID: restic.NewRandomID(),
+		}
+
+		if i%10 == 0 {
+			blob.Type = restic.TreeBlob
+			tree = append(tree, blob.ID)
+		} else {
+			data = append(data, blob.ID)
+		}
+
+		idx.Store(blob)
+	}
+
+	k, err := newKnownBlobs(context.TODO(), idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range data {
+		if !k.Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+			t.Errorf("data blob %v not found", id.Str())
+		}
+		if k.Has(restic.BlobHandle{ID: id, Type: restic.TreeBlob}) {
+			t.Errorf("data blob %v found as tree blob", id.Str())
+		}
+	}
+
+	for _, id := range tree {
+		if !k.Has(restic.BlobHandle{ID: id, Type: restic.TreeBlob}) {
+			t.Errorf("tree blob %v not found", id.Str())
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		id := restic.NewRandomID()
+		if k.Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+			t.Errorf("unknown blob %v found", id.Str())
+		}
+	}
+
+	// blobs added later are not contained in the table
+	id := restic.NewRandomID()
+	idx.Store(restic.PackedBlob{
+		Blob:   restic.Blob{Type: restic.DataBlob, ID: id},
+		PackID: restic.NewRandomID(),
+	})
+	if k.Has(restic.BlobHandle{ID: id, Type: restic.DataBlob}) {
+		t.Errorf("blob %v added after building the table was found", id.Str())
+	}
+}
+
+func BenchmarkKnownBlobsHas(b *testing.B) {
+	idx := repository.NewIndex()
+	for i := 0; i < 200000; i++ {
+		idx.Store(restic.PackedBlob{
+			Blob: restic.Blob{
+				Type: restic.DataBlob,
+				ID:   restic.NewRandomID(),
+			},
+			PackID: restic.NewRandomID(),
+		})
+	}
+
+	k, err := newKnownBlobs(context.TODO(), idx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := restic.BlobHandle{ID: restic.NewRandomID(), Type: restic.DataBlob}
+
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			k.Has(h)
+		}
+	})
+}
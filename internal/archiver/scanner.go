@@ -3,7 +3,6 @@ package archiver
 import (
 	"context"
 	"os"
-	"path/filepath"
 
 	"github.com/restic/restic/internal/fs"
 )
@@ -11,12 +10,18 @@ import (
 // Scanner  traverses the targets and calls the function Result with cumulated
 // stats concerning the files and folders found. Select is used to decide which
 // items should be included. Error is called when an error occurs.
+// Directories are read concurrently, SelectByName and Select may be called
+// from several goroutines. Result is called in a deterministic order.
 type Scanner struct {
 	FS           fs.FS
 	SelectByName SelectByNameFunc
 	Select       SelectFunc
 	Error        ErrorFunc
 	Result       func(item string, s ScanStats)
+
+	// ReadDirConcurrency sets how many directories are read concurrently. If
+	// it's set to zero, a default is used.
+	ReadDirConcurrency uint
 }
 
 // NewScanner initializes a new Scanner.
@@ -39,6 +44,8 @@ type ScanStats struct {
 // Scan traverses the targets. The function Result is called for each new item
 // found, the complete result is also returned by Scan.
 func (s *Scanner) Scan(ctx context.Context, targets []string) error {
+	r := newDirReader(s.FS, s.SelectByName, s.Select, s.ReadDirConcurrency)
+
 	var stats ScanStats
 	for _, target := range targets {
 		abstarget, err := s.FS.Abs(target)
@@ -46,7 +53,7 @@ func (s *Scanner) Scan(ctx context.Context, targets []string) error {
 			return err
 		}
 
-		stats, err = s.scan(ctx, stats, abstarget)
+		stats, err = s.scan(ctx, r, stats, abstarget)
 		if err != nil {
 			return err
 		}
@@ -60,7 +67,7 @@ func (s *Scanner) Scan(ctx context.Context, targets []string) error {
 	return nil
 }
 
-func (s *Scanner) scan(ctx context.Context, stats ScanStats, target string) (ScanStats, error) {
+func (s *Scanner) scan(ctx context.Context, r *dirReader, stats ScanStats, target string) (ScanStats, error) {
 	if ctx.Err() != nil {
 		return stats, nil
 	}
@@ -81,18 +88,54 @@ func (s *Scanner) scan(ctx context.Context, stats ScanStats, target string) (Sca
 		return stats, nil
 	}
 
+	return s.scanItem(ctx, r, stats, target, fi, nil)
+}
+
+// scanEntry processes an entry of a directory, for which the select functions
+// and Lstat have already been run.
+func (s *Scanner) scanEntry(ctx context.Context, r *dirReader, stats ScanStats, e dirEntry) (ScanStats, error) {
+	if ctx.Err() != nil {
+		return stats, nil
+	}
+
+	if e.absErr != nil {
+		return stats, s.Error(e.path, nil, e.absErr)
+	}
+
+	if !e.selectedByName {
+		return stats, nil
+	}
+
+	if e.err != nil {
+		return stats, s.Error(e.abspath, e.fi, e.err)
+	}
+
+	if !e.selected {
+		return stats, nil
+	}
+
+	return s.scanItem(ctx, r, stats, e.abspath, e.fi, e.dir)
+}
+
+func (s *Scanner) scanItem(ctx context.Context, r *dirReader, stats ScanStats, target string, fi os.FileInfo, dir *futureDir) (ScanStats, error) {
 	switch {
 	case fi.Mode().IsRegular():
 		stats.Files++
 		stats.Bytes += uint64(fi.Size())
 	case fi.Mode().IsDir():
-		names, err := readdirnames(s.FS, target)
+		entries, err := r.read(ctx, target, target, dir)
 		if err != nil {
+			if ctx.Err() != nil {
+				return stats, nil
+			}
 			return stats, s.Error(target, fi, err)
 		}
 
-		for _, name := range names {
-			stats, err = s.scan(ctx, stats, filepath.Join(target, name))
+		ra := r.readAhead(entries)
+		for i := range entries {
+			ra.advance(ctx, i)
+
+			stats, err = s.scanEntry(ctx, r, stats, entries[i])
 			if err != nil {
 				return stats, err
 			}
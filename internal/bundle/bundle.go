@@ -0,0 +1,406 @@
+// Package bundle implements a portable file format for a single snapshot
+// together with all trees and data blobs it references. A bundle can be
+// written from one repository and imported into another one, which does not
+// need to share any keys with the first.
+//
+// A bundle starts with a magic string and a JSON header, which holds a random
+// master key encrypted with a key derived from a password, like the key files
+// in a repository. The header is followed by a sequence of records, each of
+// which is the length of the ciphertext as uint32 and the encrypted and
+// authenticated record. The plaintext of a record is the record type, the
+// sequence number of the record as uint64 and the payload. The last record
+// contains the number of records before it, so that truncated bundles are
+// detected.
+package bundle
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// magic is written at the start of each bundle.
+const magic = "restic-bundle\n"
+
+// version is the current version of the bundle format.
+const version = 1
+
+// maxRecordSize is the largest record which is accepted when reading a
+// bundle, it is much larger than the largest blob created by restic.
+const maxRecordSize = 64 * 1024 * 1024
+
+// RecordType is the type of a record in a bundle.
+type RecordType byte
+
+// These are the record types.
+const (
+	DataBlobRecord RecordType = 1
+	TreeBlobRecord RecordType = 2
+	SnapshotRecord RecordType = 16
+	endRecord      RecordType = 255
+)
+
+// BlobType returns the blob type stored in a blob record.
+func (t RecordType) BlobType() restic.BlobType {
+	switch t {
+	case DataBlobRecord:
+		return restic.DataBlob
+	case TreeBlobRecord:
+		return restic.TreeBlob
+	}
+
+	return restic.InvalidBlob
+}
+
+// header is the unencrypted JSON header of a bundle.
+type header struct {
+	Version  int       `json:"version"`
+	Created  time.Time `json:"created"`
+	Hostname string    `json:"hostname,omitempty"`
+
+	KDF  string `json:"kdf"`
+	N    int    `json:"N"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+	Data []byte `json:"data"`
+}
+
+// Writer writes a bundle.
+type Writer struct {
+	wr  *bufio.Writer
+	key *crypto.Key
+	seq uint64
+	buf []byte
+}
+
+// NewWriter writes the header of a new bundle to wr and returns a Writer for
+// the records. The key for the bundle is encrypted with password, params are
+// the parameters for the key derivation function. Close must be called after
+// all records have been written.
+func NewWriter(wr io.Writer, password string, params crypto.Params, hostname string) (*Writer, error) {
+	// do not create bundles which Unlock would refuse to open
+	if err := params.CheckLimits(); err != nil {
+		return nil, err
+	}
+
+	salt, err := crypto.NewSalt()
+	if err != nil {
+		return nil, errors.Wrap(err, "NewSalt")
+	}
+
+	user, err := crypto.KDF(params, salt, password)
+	if err != nil {
+		return nil, errors.Wrap(err, "KDF")
+	}
+
+	master := crypto.NewRandomKey()
+	buf, err := json.Marshal(master)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+
+	nonce := crypto.NewRandomNonce()
+	data := make([]byte, 0, len(nonce)+len(buf)+user.Overhead())
+	data = append(data, nonce...)
+	data = user.Seal(data, nonce, buf, nil)
+
+	hdr := header{
+		Version:  version,
+		Created:  time.Now(),
+		Hostname: hostname,
+		KDF:      "scrypt",
+		N:        params.N,
+		R:        params.R,
+		P:        params.P,
+		Salt:     salt,
+		Data:     data,
+	}
+
+	buf, err = json.Marshal(hdr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Marshal")
+	}
+
+	w := &Writer{
+		wr:  bufio.NewWriter(wr),
+		key: master,
+	}
+
+	if _, err = w.wr.WriteString(magic); err != nil {
+		return nil, errors.Wrap(err, "Write")
+	}
+
+	if err = w.writeFrame(buf); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// writeFrame writes the length of buf followed by buf.
+func (w *Writer) writeFrame(buf []byte) error {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(buf)))
+
+	if _, err := w.wr.Write(length[:]); err != nil {
+		return errors.Wrap(err, "Write")
+	}
+
+	if _, err := w.wr.Write(buf); err != nil {
+		return errors.Wrap(err, "Write")
+	}
+
+	return nil
+}
+
+// writeRecord encrypts and writes a record.
+func (w *Writer) writeRecord(t RecordType, payload []byte) error {
+	plaintext := make([]byte, 9, 9+len(payload))
+	plaintext[0] = byte(t)
+	binary.LittleEndian.PutUint64(plaintext[1:], w.seq)
+	plaintext = append(plaintext, payload...)
+
+	nonce := crypto.NewRandomNonce()
+	w.buf = append(w.buf[:0], nonce...)
+	w.buf = w.key.Seal(w.buf, nonce, plaintext, nil)
+
+	if err := w.writeFrame(w.buf); err != nil {
+		return err
+	}
+
+	w.seq++
+	return nil
+}
+
+// WriteBlob adds the plaintext of a blob to the bundle.
+func (w *Writer) WriteBlob(t restic.BlobType, buf []byte) error {
+	switch t {
+	case restic.DataBlob:
+		return w.writeRecord(DataBlobRecord, buf)
+	case restic.TreeBlob:
+		return w.writeRecord(TreeBlobRecord, buf)
+	}
+
+	return errors.Errorf("invalid blob type %v", t)
+}
+
+// WriteSnapshot adds the snapshot sn to the bundle.
+func (w *Writer) WriteSnapshot(sn *restic.Snapshot) error {
+	buf, err := json.Marshal(sn)
+	if err != nil {
+		return errors.Wrap(err, "Marshal")
+	}
+
+	return w.writeRecord(SnapshotRecord, buf)
+}
+
+// Close finishes the bundle and flushes all buffered data. It does not close
+// the underlying writer.
+func (w *Writer) Close() error {
+	var count [8]byte
+	binary.LittleEndian.PutUint64(count[:], w.seq)
+
+	if err := w.writeRecord(endRecord, count[:]); err != nil {
+		return err
+	}
+
+	return errors.Wrap(w.wr.Flush(), "Flush")
+}
+
+// Record is a record read from a bundle.
+type Record struct {
+	Type RecordType
+	Data []byte
+}
+
+// Reader reads a bundle.
+type Reader struct {
+	rd  *bufio.Reader
+	hdr header
+	key *crypto.Key
+	seq uint64
+	eof bool
+}
+
+// NewReader reads the header of the bundle from rd. Unlock must be called
+// before records can be read.
+func NewReader(rd io.Reader) (*Reader, error) {
+	r := &Reader{rd: bufio.NewReader(rd)}
+
+	buf := make([]byte, len(magic))
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return nil, errors.Wrap(err, "ReadFull")
+	}
+
+	if string(buf) != magic {
+		return nil, errors.New("not a restic bundle")
+	}
+
+	buf, err := r.readFrame()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(buf, &r.hdr); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	if r.hdr.Version != version {
+		return nil, errors.Errorf("unsupported bundle version %d", r.hdr.Version)
+	}
+
+	if r.hdr.KDF != "scrypt" {
+		return nil, errors.New("only supported KDF is scrypt()")
+	}
+
+	return r, nil
+}
+
+// Created returns the time the bundle was created at.
+func (r *Reader) Created() time.Time {
+	return r.hdr.Created
+}
+
+// Hostname returns the name of the host the bundle was created on.
+func (r *Reader) Hostname() string {
+	return r.hdr.Hostname
+}
+
+// ErrWrongPassword is returned by Unlock if the key of the bundle cannot be
+// decrypted with the password.
+var ErrWrongPassword = errors.New("wrong password for bundle")
+
+// Unlock decrypts the key of the bundle with password.
+func (r *Reader) Unlock(password string) error {
+	// the header is not authenticated yet, so refuse parameters which would
+	// need huge amounts of memory or CPU time
+	params := crypto.Params{N: r.hdr.N, R: r.hdr.R, P: r.hdr.P}
+	if err := params.CheckLimits(); err != nil {
+		return errors.Wrap(err, "invalid bundle header")
+	}
+
+	user, err := crypto.KDF(params, r.hdr.Salt, password)
+	if err != nil {
+		return errors.Wrap(err, "KDF")
+	}
+
+	if len(r.hdr.Data) < user.NonceSize() {
+		return errors.New("invalid bundle header")
+	}
+
+	nonce, ciphertext := r.hdr.Data[:user.NonceSize()], r.hdr.Data[user.NonceSize():]
+	buf, err := user.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		debug.Log("unable to decrypt bundle key: %v", err)
+		return ErrWrongPassword
+	}
+
+	key := &crypto.Key{}
+	if err = json.Unmarshal(buf, key); err != nil {
+		return errors.Wrap(err, "Unmarshal")
+	}
+
+	if !key.Valid() {
+		return errors.New("invalid key in bundle")
+	}
+
+	r.key = key
+	return nil
+}
+
+// readFrame reads a length and the data following it.
+func (r *Reader) readFrame() ([]byte, error) {
+	var length [4]byte
+	if _, err := io.ReadFull(r.rd, length[:]); err != nil {
+		return nil, err
+	}
+
+	n := binary.LittleEndian.Uint32(length[:])
+	if n > maxRecordSize {
+		return nil, errors.Errorf("record too large (%d bytes)", n)
+	}
+
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(r.rd, buf); err != nil {
+		return nil, errors.Wrap(err, "ReadFull")
+	}
+
+	return buf, nil
+}
+
+// Next returns the next record of the bundle. After the last record, io.EOF
+// is returned. Truncated or modified bundles are detected and an error is
+// returned.
+func (r *Reader) Next() (*Record, error) {
+	if r.key == nil {
+		return nil, errors.New("bundle is locked")
+	}
+
+	if r.eof {
+		return nil, io.EOF
+	}
+
+	buf, err := r.readFrame()
+	if err == io.EOF || errors.Cause(err) == io.ErrUnexpectedEOF {
+		return nil, errors.New("bundle is truncated")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(buf) < r.key.NonceSize() {
+		return nil, errors.New("invalid record")
+	}
+
+	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
+	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("record %d: %v", r.seq, err)
+	}
+
+	if len(plaintext) < 9 {
+		return nil, errors.Errorf("record %d is too short", r.seq)
+	}
+
+	t := RecordType(plaintext[0])
+	seq := binary.LittleEndian.Uint64(plaintext[1:])
+	if seq != r.seq {
+		return nil, errors.Errorf("record %d has wrong sequence number %d", r.seq, seq)
+	}
+	r.seq++
+
+	data := plaintext[9:]
+
+	if t == endRecord {
+		if len(data) != 8 || binary.LittleEndian.Uint64(data) != seq {
+			return nil, errors.New("bundle is incomplete")
+		}
+
+		r.eof = true
+		return nil, io.EOF
+	}
+
+	return &Record{Type: t, Data: data}, nil
+}
+
+// DecodeSnapshot returns the snapshot stored in a snapshot record.
+func DecodeSnapshot(rec *Record) (*restic.Snapshot, error) {
+	if rec.Type != SnapshotRecord {
+		return nil, errors.Errorf("record type %d is not a snapshot", rec.Type)
+	}
+
+	sn := &restic.Snapshot{}
+	if err := json.Unmarshal(rec.Data, sn); err != nil {
+		return nil, errors.Wrap(err, "Unmarshal")
+	}
+
+	return sn, nil
+}
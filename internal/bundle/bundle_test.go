@@ -0,0 +1,140 @@
+package bundle_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/restic/restic/internal/bundle"
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+var testParams = crypto.Params{N: 128, R: 1, P: 1}
+
+type testRecord struct {
+	tpe  bundle.RecordType
+	data []byte
+}
+
+func writeTestBundle(t testing.TB) ([]byte, []testRecord, *restic.Snapshot) {
+	buf := bytes.NewBuffer(nil)
+	wr, err := bundle.NewWriter(buf, "secret", testParams, "testhost")
+	rtest.OK(t, err)
+
+	var records []testRecord
+	for i := 0; i < 20; i++ {
+		tpe, rtpe := restic.DataBlob, bundle.DataBlobRecord
+		if i%3 == 0 {
+			tpe, rtpe = restic.TreeBlob, bundle.TreeBlobRecord
+		}
+
+		data := rtest.Random(i, 1000+i*100)
+		rtest.OK(t, wr.WriteBlob(tpe, data))
+		records = append(records, testRecord{tpe: rtpe, data: data})
+	}
+
+	sn, err := restic.NewSnapshot([]string{"/foo/bar"}, []string{"tag"}, "host", time.Unix(1500000000, 0))
+	rtest.OK(t, err)
+	tree := restic.NewRandomID()
+	sn.Tree = &tree
+
+	rtest.OK(t, wr.WriteSnapshot(sn))
+	rtest.OK(t, wr.Close())
+
+	return buf.Bytes(), records, sn
+}
+
+func readAll(t testing.TB, buf []byte, password string) ([]*bundle.Record, error) {
+	rd, err := bundle.NewReader(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	if err = rd.Unlock(password); err != nil {
+		return nil, err
+	}
+
+	var records []*bundle.Record
+	for {
+		rec, err := rd.Next()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, err
+		}
+		records = append(records, rec)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	buf, want, sn := writeTestBundle(t)
+
+	rd, err := bundle.NewReader(bytes.NewReader(buf))
+	rtest.OK(t, err)
+	rtest.Equals(t, "testhost", rd.Hostname())
+
+	records, err := readAll(t, buf, "secret")
+	rtest.OK(t, err)
+	rtest.Equals(t, len(want)+1, len(records))
+
+	for i, rec := range want {
+		rtest.Equals(t, rec.tpe, records[i].Type)
+		if !bytes.Equal(rec.data, records[i].Data) {
+			t.Errorf("record %d has wrong data", i)
+		}
+	}
+
+	sn2, err := bundle.DecodeSnapshot(records[len(records)-1])
+	rtest.OK(t, err)
+	rtest.Equals(t, sn.Paths, sn2.Paths)
+	rtest.Equals(t, sn.Tags, sn2.Tags)
+	rtest.Equals(t, *sn.Tree, *sn2.Tree)
+	rtest.Assert(t, sn.Time.Equal(sn2.Time), "wrong time, want %v, got %v", sn.Time, sn2.Time)
+}
+
+func TestBundleWrongPassword(t *testing.T) {
+	buf, _, _ := writeTestBundle(t)
+
+	_, err := readAll(t, buf, "wrong")
+	rtest.Assert(t, err == bundle.ErrWrongPassword, "expected wrong password error, got %v", err)
+}
+
+func TestBundleTruncated(t *testing.T) {
+	buf, _, _ := writeTestBundle(t)
+
+	for _, n := range []int{len(buf) - 1, len(buf) - 60, len(buf) / 2} {
+		_, err := readAll(t, buf[:n], "secret")
+		rtest.Assert(t, err != nil, "truncated bundle (%d of %d bytes) was accepted", n, len(buf))
+	}
+}
+
+func TestBundleModified(t *testing.T) {
+	buf, _, _ := writeTestBundle(t)
+
+	buf[len(buf)/2] ^= 0x01
+
+	_, err := readAll(t, buf, "secret")
+	rtest.Assert(t, err != nil, "modified bundle was accepted")
+}
+
+func TestBundleHugeKDFParams(t *testing.T) {
+	hdr := []byte(`{"version":1,"kdf":"scrypt","N":1073741824,"r":8,"p":1,"salt":"","data":""}`)
+
+	buf := bytes.NewBuffer(nil)
+	buf.WriteString("restic-bundle\n")
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(hdr)))
+	buf.Write(length[:])
+	buf.Write(hdr)
+
+	rd, err := bundle.NewReader(buf)
+	rtest.OK(t, err)
+
+	err = rd.Unlock("secret")
+	rtest.Assert(t, err != nil, "bundle with huge KDF parameters was accepted")
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/restic"
+)
+
+// statsDir is the subdirectory of the cache which holds statistics computed
+// for snapshots. As snapshots are never modified, the statistics for a
+// snapshot stay valid until it is removed.
+const statsDir = "stats"
+
+func (c *Cache) statsFilename(mode string, id restic.ID) string {
+	return filepath.Join(c.Path, statsDir, mode, id.String())
+}
+
+// LoadStats returns the statistics for the snapshot id which were saved for
+// the counting mode. The data is returned as it was passed to SaveStats. If
+// nothing has been saved, the returned error satisfies IsNotExist.
+func (c *Cache) LoadStats(mode string, id restic.ID) ([]byte, error) {
+	buf, err := ioutil.ReadFile(c.statsFilename(mode, id))
+	if os.IsNotExist(err) {
+		return nil, errNoSuchFile{Type: statsDir + "/" + mode, Name: id.String()}
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "ReadFile")
+	}
+
+	return buf, nil
+}
+
+// SaveStats saves the statistics for the snapshot id for the counting mode,
+// replacing any data saved before.
+func (c *Cache) SaveStats(mode string, id restic.ID, data []byte) error {
+	debug.Log("Save stats to cache: %v %v", mode, id.Str())
+
+	dir := filepath.Join(c.Path, statsDir, mode)
+	if err := fs.MkdirAll(dir, dirMode); err != nil {
+		return errors.Wrap(err, "MkdirAll")
+	}
+
+	// write to a temporary file first so that concurrent readers never see
+	// partially written data
+	f, err := ioutil.TempFile(dir, "tmp-")
+	if err != nil {
+		return errors.Wrap(err, "TempFile")
+	}
+
+	if _, err = f.Write(data); err != nil {
+		_ = f.Close()
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Write")
+	}
+
+	if err = f.Close(); err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Close")
+	}
+
+	if err = fs.Rename(f.Name(), c.statsFilename(mode, id)); err != nil {
+		_ = fs.Remove(f.Name())
+		return errors.Wrap(err, "Rename")
+	}
+
+	return nil
+}
+
+// ClearStats removes the statistics of all snapshots which are not contained
+// in the set valid, for all counting modes.
+func (c *Cache) ClearStats(valid restic.IDSet) error {
+	debug.Log("Clearing stats cache: %v valid snapshots", len(valid))
+
+	dir := filepath.Join(c.Path, statsDir)
+	err := filepath.Walk(dir, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return errors.Wrap(err, "Walk")
+		}
+
+		if !isFile(fi) {
+			return nil
+		}
+
+		id, err := restic.ParseID(fi.Name())
+		if err == nil && valid.Has(id) {
+			return nil
+		}
+
+		// remove stale entries as well as leftover temporary files
+		return fs.Remove(name)
+	})
+
+	return err
+}
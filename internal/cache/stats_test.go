@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+	"github.com/restic/restic/internal/test"
+)
+
+func TestStats(t *testing.T) {
+	c, cleanup := TestNewCache(t)
+	defer cleanup()
+
+	id1, id2 := restic.NewRandomID(), restic.NewRandomID()
+
+	_, err := c.LoadStats("raw-data", id1)
+	if !c.IsNotExist(err) {
+		t.Fatalf("expected not exist error, got %v", err)
+	}
+
+	for _, id := range []restic.ID{id1, id2} {
+		test.OK(t, c.SaveStats("raw-data", id, id[:]))
+		test.OK(t, c.SaveStats("restore-size", id, []byte("foo")))
+	}
+
+	// saving again replaces the data
+	test.OK(t, c.SaveStats("restore-size", id1, []byte("bar")))
+
+	buf, err := c.LoadStats("raw-data", id1)
+	test.OK(t, err)
+	if !bytes.Equal(buf, id1[:]) {
+		t.Errorf("wrong data returned, want %x, got %x", id1[:], buf)
+	}
+
+	buf, err = c.LoadStats("restore-size", id1)
+	test.OK(t, err)
+	test.Equals(t, "bar", string(buf))
+
+	test.OK(t, c.ClearStats(restic.NewIDSet(id2)))
+
+	for _, mode := range []string{"raw-data", "restore-size"} {
+		_, err = c.LoadStats(mode, id1)
+		if !c.IsNotExist(err) {
+			t.Errorf("stats for %v not removed, error %v", mode, err)
+		}
+
+		_, err = c.LoadStats(mode, id2)
+		test.OK(t, err)
+	}
+}
@@ -2,17 +2,20 @@ package checker
 
 import (
 	"context"
+	"crypto/sha256"
 	"fmt"
 	"io"
-	"os"
+	"io/ioutil"
+	"sort"
 	"sync"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
-	"github.com/restic/restic/internal/pack"
+	"github.com/restic/restic/internal/hashing"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
 )
 
 // Checker runs various checks on a repository. It is advisable to create an
@@ -29,9 +32,17 @@ type Checker struct {
 	}
 	indexes map[restic.ID]*repository.Index
 
+	damagedPacks struct {
+		sync.Mutex
+		S restic.IDSet
+	}
+
 	masterIndex *repository.MasterIndex
 
 	repo restic.Repository
+
+	// readDataMemory limits the memory used for blobs while reading packs
+	readDataMemory int64
 }
 
 // New returns a new checker which runs on repo.
@@ -42,15 +53,32 @@ func New(repo restic.Repository) *Checker {
 		masterIndex: repository.NewMasterIndex(),
 		indexes:     make(map[restic.ID]*repository.Index),
 		repo:        repo,
+
+		readDataMemory: defaultReadDataMemory,
 	}
 
 	c.blobRefs.M = make(map[restic.ID]uint)
+	c.damagedPacks.S = restic.NewIDSet()
 
 	return c
 }
 
 const defaultParallelism = 5
 
+// defaultReadDataMemory is the default amount of memory used for buffering
+// blobs while the data of the packs is read.
+const defaultReadDataMemory = 64 * 1024 * 1024
+
+// SetReadDataMemory limits the memory used for buffering blobs while packs are
+// read by ReadData and ReadPacks to limit bytes. Blobs larger than the limit
+// are not checked, this is reported as a PackError with Unchecked set.
+func (c *Checker) SetReadDataMemory(limit int64) {
+	if limit <= 0 {
+		limit = defaultReadDataMemory
+	}
+	c.readDataMemory = limit
+}
+
 // ErrDuplicatePacks is returned when a pack is found in more than one index.
 type ErrDuplicatePacks struct {
 	PackID  restic.ID
@@ -170,6 +198,10 @@ func (c *Checker) LoadIndex(ctx context.Context) (hints []error, errs []error) {
 				packToIndex[blob.PackID].Insert(res.ID)
 			}
 
+			if err := res.Index.Err(); err != nil {
+				errs = append(errs, errors.Wrapf(err, "error reading index %v", res.ID.Str()))
+			}
+
 			debug.Log("%d blobs processed", cnt)
 		}
 		return nil
@@ -200,11 +232,13 @@ func (c *Checker) LoadIndex(ctx context.Context) (hints []error, errs []error) {
 	return hints, errs
 }
 
-// PackError describes an error with a specific pack.
+// PackError describes an error with a specific pack. If Unchecked is set, the
+// pack is not known to be damaged, but some of its blobs could not be checked.
 type PackError struct {
-	ID       restic.ID
-	Orphaned bool
-	Err      error
+	ID        restic.ID
+	Orphaned  bool
+	Unchecked bool
+	Err       error
 }
 
 func (e PackError) Error() string {
@@ -695,74 +729,161 @@ func (c *Checker) GetPacks() restic.IDSet {
 	return c.packs
 }
 
-// checkPack reads a pack and checks the integrity of all blobs.
-func checkPack(ctx context.Context, r restic.Repository, id restic.ID) error {
+// checkPack streams a pack from the backend and checks the integrity of all
+// blobs. The pack is hashed while it is read and the blobs are decrypted on
+// the fly, nothing is stored on disk. A buffer for the largest blob of the pack
+// is reserved from mem, which holds at most memLimit bytes. Blobs larger than
+// memLimit are skipped.
+//
+// If the pack was read completely and its content is damaged, a PackError is
+// returned. If the pack is intact but blobs were skipped, the PackError has
+// Unchecked set. Errors while reading the pack from the backend are returned
+// as is.
+func checkPack(ctx context.Context, r restic.Repository, id restic.ID, mem *semaphore.Weighted, memLimit int64) error {
 	debug.Log("checking pack %v", id)
 	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
 
-	packfile, hash, size, err := repository.DownloadAndHash(ctx, r.Backend(), h)
+	fi, err := r.Backend().Stat(ctx, h)
 	if err != nil {
 		return errors.Wrap(err, "checkPack")
 	}
 
-	defer func() {
-		_ = packfile.Close()
-		_ = os.Remove(packfile.Name())
-	}()
-
-	debug.Log("hash for pack %v is %v", id, hash)
-
-	if !hash.Equal(id) {
-		debug.Log("Pack ID does not match, want %v, got %v", id, hash)
-		return errors.Errorf("Pack ID does not match, want %v, got %v", id.Str(), hash.Str())
+	// read the header first, so the blobs can be checked while the pack is
+	// streamed. If the header is damaged, the pack is still hashed to report
+	// a mismatching pack ID.
+	blobs, _, listErr := r.ListPack(ctx, id, fi.Size)
+	for _, blob := range blobs {
+		if int64(blob.Offset)+int64(blob.Length) > fi.Size {
+			listErr = errors.Errorf("blob %v extends beyond the end of the pack", blob.ID.Str())
+			break
+		}
 	}
-
-	blobs, err := pack.List(r.Key(), packfile, size)
-	if err != nil {
-		return err
+	if listErr != nil {
+		debug.Log("  error reading header of pack %v: %v", id, listErr)
+		blobs = nil
 	}
 
-	var errs []error
-	var buf []byte
-	for i, blob := range blobs {
-		debug.Log("  check blob %d: %v", i, blob)
+	sort.Slice(blobs, func(i, j int) bool {
+		return blobs[i].Offset < blobs[j].Offset
+	})
 
-		buf = buf[:cap(buf)]
-		if uint(len(buf)) < blob.Length {
-			buf = make([]byte, blob.Length)
+	// reserve memory for the largest blob, blobs larger than the limit are
+	// skipped
+	var need int64
+	for _, blob := range blobs {
+		if int64(blob.Length) > need && int64(blob.Length) <= memLimit {
+			need = int64(blob.Length)
 		}
-		buf = buf[:blob.Length]
+	}
 
-		_, err := packfile.Seek(int64(blob.Offset), 0)
+	if need > 0 {
+		err = mem.Acquire(ctx, need)
 		if err != nil {
-			return errors.Errorf("Seek(%v): %v", blob.Offset, err)
+			return err
 		}
+		defer mem.Release(need)
+	}
 
-		_, err = io.ReadFull(packfile, buf)
-		if err != nil {
-			debug.Log("  error loading blob %v: %v", blob.ID, err)
-			errs = append(errs, errors.Errorf("blob %v: %v", i, err))
-			continue
+	var (
+		hash    restic.ID
+		size    int64
+		errs    []error
+		skipped []error
+	)
+
+	err = r.Backend().Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		// start over if the backend retries the request
+		errs = nil
+		skipped = nil
+		hrd := hashing.NewReader(rd, sha256.New())
+
+		var pos int64
+		var buf []byte
+		for i, blob := range blobs {
+			debug.Log("  check blob %d: %v", i, blob)
+
+			// the blobs are stored one after another, skip anything in
+			// between
+			if int64(blob.Offset) > pos {
+				n, err := io.CopyN(ioutil.Discard, hrd, int64(blob.Offset)-pos)
+				pos += n
+				if err != nil {
+					return errors.Wrap(err, "skip")
+				}
+			}
+
+			if int64(blob.Length) > memLimit {
+				debug.Log("  blob %v is larger than the memory limit, skipping", blob.ID)
+				skipped = append(skipped, errors.Errorf("blob %v: size %d exceeds the memory limit of %d bytes", i, blob.Length, memLimit))
+				continue
+			}
+
+			if uint(cap(buf)) < blob.Length {
+				buf = make([]byte, blob.Length)
+			}
+			buf = buf[:blob.Length]
+
+			n, err := io.ReadFull(hrd, buf)
+			pos += int64(n)
+			if err != nil {
+				return errors.Wrapf(err, "blob %v", i)
+			}
+
+			nonce, ciphertext := buf[:r.Key().NonceSize()], buf[r.Key().NonceSize():]
+			plaintext, err := r.Key().Open(ciphertext[:0], nonce, ciphertext, nil)
+			if err != nil {
+				debug.Log("  error decrypting blob %v: %v", blob.ID, err)
+				errs = append(errs, errors.Errorf("blob %v: %v", i, err))
+				continue
+			}
+
+			hash := restic.Hash(plaintext)
+			if !hash.Equal(blob.ID) {
+				debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
+				errs = append(errs, errors.Errorf("Blob ID does not match, want %v, got %v", blob.ID.Str(), hash.Str()))
+				continue
+			}
 		}
 
-		nonce, ciphertext := buf[:r.Key().NonceSize()], buf[r.Key().NonceSize():]
-		plaintext, err := r.Key().Open(ciphertext[:0], nonce, ciphertext, nil)
+		// hash the rest of the pack, which contains the header
+		n, err := io.Copy(ioutil.Discard, hrd)
 		if err != nil {
-			debug.Log("  error decrypting blob %v: %v", blob.ID, err)
-			errs = append(errs, errors.Errorf("blob %v: %v", i, err))
-			continue
+			return err
 		}
 
-		hash := restic.Hash(plaintext)
-		if !hash.Equal(blob.ID) {
-			debug.Log("  Blob ID does not match, want %v, got %v", blob.ID, hash)
-			errs = append(errs, errors.Errorf("Blob ID does not match, want %v, got %v", blob.ID.Str(), hash.Str()))
-			continue
-		}
+		size = pos + n
+		hash = restic.IDFromHash(hrd.Sum(nil))
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "checkPack")
+	}
+
+	// the pack was not read completely, so nothing can be said about its
+	// content
+	if size != fi.Size {
+		return errors.Errorf("checkPack: read %d bytes of pack %v, expected %d", size, id.Str(), fi.Size)
+	}
+
+	debug.Log("hash for pack %v is %v", id, hash)
+
+	if !hash.Equal(id) {
+		debug.Log("Pack ID does not match, want %v, got %v", id, hash)
+		return PackError{ID: id, Err: errors.Errorf("Pack ID does not match, want %v, got %v", id.Str(), hash.Str())}
+	}
+
+	// the header of an intact pack can only fail to load because of an error
+	// in the backend
+	if listErr != nil {
+		return listErr
 	}
 
 	if len(errs) > 0 {
-		return errors.Errorf("pack %v contains %v errors: %v", id.Str(), len(errs), errs)
+		return PackError{ID: id, Err: errors.Errorf("%v errors: %v", len(errs), errs)}
+	}
+
+	if len(skipped) > 0 {
+		return PackError{ID: id, Unchecked: true, Err: errors.Errorf("%v blobs not checked: %v", len(skipped), skipped)}
 	}
 
 	return nil
@@ -773,6 +894,20 @@ func (c *Checker) ReadData(ctx context.Context, p *restic.Progress, errChan chan
 	c.ReadPacks(ctx, c.packs, p, errChan)
 }
 
+// DamagedPacks returns the IDs of all packs which were read completely by
+// ReadPacks and found to be damaged. Packs which could not be read are not
+// included.
+func (c *Checker) DamagedPacks() restic.IDSet {
+	c.damagedPacks.Lock()
+	defer c.damagedPacks.Unlock()
+
+	packs := restic.NewIDSet()
+	for id := range c.damagedPacks.S {
+		packs.Insert(id)
+	}
+	return packs
+}
+
 // ReadPacks loads data from specified packs and checks the integrity.
 func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.Progress, errChan chan<- error) {
 	defer close(errChan)
@@ -782,6 +917,7 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 
 	g, ctx := errgroup.WithContext(ctx)
 	ch := make(chan restic.ID)
+	mem := semaphore.NewWeighted(c.readDataMemory)
 
 	// run workers
 	for i := 0; i < defaultParallelism; i++ {
@@ -799,12 +935,18 @@ func (c *Checker) ReadPacks(ctx context.Context, packs restic.IDSet, p *restic.P
 					}
 				}
 
-				err := checkPack(ctx, c.repo, id)
+				err := checkPack(ctx, c.repo, id, mem, c.readDataMemory)
 				p.Report(restic.Stat{Blobs: 1})
 				if err == nil {
 					continue
 				}
 
+				if e, ok := errors.Cause(err).(PackError); ok && !e.Unchecked {
+					c.damagedPacks.Lock()
+					c.damagedPacks.S.Insert(id)
+					c.damagedPacks.Unlock()
+				}
+
 				select {
 				case <-ctx.Done():
 					return nil
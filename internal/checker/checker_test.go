@@ -8,10 +8,12 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/restic/restic/internal/archiver"
 	"github.com/restic/restic/internal/checker"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	"github.com/restic/restic/internal/test"
@@ -363,6 +365,144 @@ func TestCheckerModifiedData(t *testing.T) {
 	}
 }
 
+func TestCheckerReadData(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	// packs are streamed, so no temporary files are needed
+	tmpdir := os.Getenv("TMPDIR")
+	test.OK(t, os.Setenv("TMPDIR", filepath.Join(repodir, "does-not-exist")))
+	defer func() {
+		test.OK(t, os.Setenv("TMPDIR", tmpdir))
+	}()
+
+	for _, limit := range []int64{0, 2 * 1024 * 1024} {
+		chkr := checker.New(repo)
+		chkr.SetReadDataMemory(limit)
+
+		hints, errs := chkr.LoadIndex(context.TODO())
+		if len(errs) > 0 {
+			t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+		}
+
+		if len(hints) > 0 {
+			t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+		}
+
+		test.OKs(t, checkData(chkr))
+	}
+}
+
+func TestCheckerReadDataMemoryLimit(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	// all blobs are larger than the limit
+	chkr := checker.New(repo)
+	chkr.SetReadDataMemory(1)
+
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	if len(hints) > 0 {
+		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+	}
+
+	errs = checkData(chkr)
+	test.Equals(t, len(chkr.GetPacks()), len(errs))
+	for _, err := range errs {
+		e, ok := errors.Cause(err).(checker.PackError)
+		test.Assert(t, ok, "expected PackError, got %v", err)
+		test.Assert(t, e.Unchecked, "pack %v not reported as unchecked: %v", e.ID.Str(), err)
+	}
+
+	// intact packs must not be salvaged
+	test.Equals(t, 0, len(chkr.DamagedPacks()))
+}
+
+func TestCheckerModifiedPack(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	repo := repository.TestOpenLocal(t, repodir)
+
+	chkr := checker.New(repo)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	if len(hints) > 0 {
+		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+	}
+
+	// flip a bit in the first blob of a pack
+	var packID restic.ID
+	for id := range chkr.GetPacks() {
+		packID = id
+		break
+	}
+
+	packfile := filepath.Join(repodir, "data", packID.String()[:2], packID.String())
+	test.OK(t, os.Chmod(packfile, 0644))
+	buf, err := ioutil.ReadFile(packfile)
+	test.OK(t, err)
+	buf[20] ^= 1
+	test.OK(t, ioutil.WriteFile(packfile, buf, 0644))
+
+	errs = checkData(chkr)
+	if len(errs) != 1 {
+		t.Fatalf("expected one error, got %v: %v", len(errs), errs)
+	}
+
+	test.Assert(t, strings.Contains(errs[0].Error(), "Pack ID does not match"),
+		"unexpected error for modified pack: %v", errs[0])
+	test.Equals(t, restic.NewIDSet(packID), chkr.DamagedPacks())
+}
+
+// failLoadBackend returns an error for every pack which is loaded.
+type failLoadBackend struct {
+	restic.Backend
+}
+
+func (be failLoadBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type == restic.DataFile {
+		return errors.New("load failed")
+	}
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestCheckerLoadError(t *testing.T) {
+	repodir, cleanup := test.Env(t, checkerTestData)
+	defer cleanup()
+
+	be := repository.TestOpenLocal(t, repodir).Backend()
+	repo := repository.New(failLoadBackend{Backend: be})
+	test.OK(t, repo.SearchKey(context.TODO(), test.TestPassword, 5, ""))
+
+	chkr := checker.New(repo)
+	hints, errs := chkr.LoadIndex(context.TODO())
+	if len(errs) > 0 {
+		t.Fatalf("expected no errors, got %v: %v", len(errs), errs)
+	}
+
+	if len(hints) > 0 {
+		t.Errorf("expected no hints, got %v: %v", len(hints), hints)
+	}
+
+	errs = checkData(chkr)
+	test.Assert(t, len(errs) > 0, "no errors found for packs which cannot be loaded")
+
+	// packs which could not be read are not damaged
+	test.Equals(t, 0, len(chkr.DamagedPacks()))
+}
+
 func BenchmarkChecker(t *testing.B) {
 	repodir, cleanup := test.Env(t, checkerTestData)
 	defer cleanup()
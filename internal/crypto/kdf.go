@@ -26,7 +26,56 @@ var DefaultKDFParams = Params{
 	P: sscrypt.DefaultParams.P,
 }
 
-// Calibrate determines new KDF parameters for the current hardware.
+// Check returns an error if the parameters are not valid for scrypt.
+func (p Params) Check() error {
+	// scrypt requires N to be a power of two
+	if p.N <= 1 || p.N&(p.N-1) != 0 {
+		return errors.Errorf("invalid scrypt parameter N=%d, must be a power of two", p.N)
+	}
+
+	params := sscrypt.Params{
+		N:       p.N,
+		R:       p.R,
+		P:       p.P,
+		DKLen:   sscrypt.DefaultParams.DKLen,
+		SaltLen: saltLength,
+	}
+
+	return params.Check()
+}
+
+// Upper bounds for parameters checked with CheckLimits. With the largest
+// accepted parameters, deriving a key needs 1 GiB of memory.
+const (
+	maxKDFMemory = 1 << 30 // 128 * N * r bytes
+	maxKDFWork   = 1 << 26 // N * r * p
+)
+
+// CheckLimits returns an error if the parameters are not valid for scrypt or
+// deriving a key with them would need an unreasonable amount of memory or CPU
+// time. It must be used for parameters read from untrusted sources.
+func (p Params) CheckLimits() error {
+	if err := p.Check(); err != nil {
+		return err
+	}
+
+	n, r, par := int64(p.N), int64(p.R), int64(p.P)
+	if n > maxKDFMemory/(128*r) {
+		return errors.Errorf("scrypt parameters N=%d, r=%d need too much memory", p.N, p.R)
+	}
+
+	if n*r > maxKDFWork/par {
+		return errors.Errorf("scrypt parameters N=%d, r=%d, p=%d need too much time", p.N, p.R, p.P)
+	}
+
+	return nil
+}
+
+// Calibrate determines new KDF parameters for the current hardware. The
+// parameters are chosen such that the KDF uses at most memory MiB and
+// deriving a key takes between roughly half of timeout and timeout. On slow
+// machines N is reduced until the KDF finishes in time, on fast machines p is
+// increased.
 func Calibrate(timeout time.Duration, memory int) (Params, error) {
 	defaultParams := sscrypt.Params{
 		N:       DefaultKDFParams.N,
@@ -56,15 +105,7 @@ func KDF(p Params, salt []byte, password string) (*Key, error) {
 	}
 
 	// make sure we have valid parameters
-	params := sscrypt.Params{
-		N:       p.N,
-		R:       p.R,
-		P:       p.P,
-		DKLen:   sscrypt.DefaultParams.DKLen,
-		SaltLen: len(salt),
-	}
-
-	if err := params.Check(); err != nil {
+	if err := p.Check(); err != nil {
 		return nil, errors.Wrap(err, "Check")
 	}
 
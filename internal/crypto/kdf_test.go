@@ -12,3 +12,84 @@ func TestCalibrate(t *testing.T) {
 	}
 	t.Logf("testing calibrate, params after: %v", params)
 }
+
+func TestCalibrateTimeout(t *testing.T) {
+	timeout := 200 * time.Millisecond
+	params, err := Calibrate(timeout, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := params.Check(); err != nil {
+		t.Fatalf("calibrated parameters %v are invalid: %v", params, err)
+	}
+
+	if 128*params.N*params.R > 16<<20 {
+		t.Errorf("calibrated parameters %v use more than 16 MiB", params)
+	}
+
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	_, err = KDF(params, salt, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := time.Since(start)
+
+	// the duration depends on the load of the machine, so only catch
+	// parameters which are far off
+	if d > 5*timeout {
+		t.Errorf("KDF with calibrated parameters %v took %v, timeout was %v", params, d, timeout)
+	}
+}
+
+func TestParamsCheck(t *testing.T) {
+	var tests = []struct {
+		p     Params
+		valid bool
+	}{
+		{DefaultKDFParams, true},
+		{Params{N: 1 << 15, R: 8, P: 4}, true},
+		{Params{N: 1000, R: 8, P: 1}, false},
+		{Params{N: 1 << 15, R: 0, P: 1}, false},
+		{Params{N: 1 << 15, R: 8, P: 0}, false},
+	}
+
+	for _, test := range tests {
+		err := test.p.Check()
+		if test.valid && err != nil {
+			t.Errorf("params %v: unexpected error %v", test.p, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("params %v: expected error, got none", test.p)
+		}
+	}
+}
+
+func TestParamsCheckLimits(t *testing.T) {
+	var tests = []struct {
+		p     Params
+		valid bool
+	}{
+		{DefaultKDFParams, true},
+		{Params{N: 1 << 20, R: 8, P: 8}, true},
+		{Params{N: 1 << 21, R: 8, P: 1}, false},
+		{Params{N: 1 << 15, R: 1 << 20, P: 1}, false},
+		{Params{N: 1 << 20, R: 8, P: 16}, false},
+		{Params{N: 1000, R: 8, P: 1}, false},
+	}
+
+	for _, test := range tests {
+		err := test.p.CheckLimits()
+		if test.valid && err != nil {
+			t.Errorf("params %v: unexpected error %v", test.p, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("params %v: expected error, got none", test.p)
+		}
+	}
+}
@@ -54,6 +54,12 @@ func (fs Local) Lstat(name string) (os.FileInfo, error) {
 	return os.Lstat(fixpath(name))
 }
 
+// EvalSymlinks returns the path name after the evaluation of any symbolic
+// links.
+func (fs Local) EvalSymlinks(name string) (string, error) {
+	return filepath.EvalSymlinks(fixpath(name))
+}
+
 // Join joins any number of path elements into a single path, adding a
 // Separator if necessary. Join calls Clean on the result; in particular, all
 // empty strings are ignored. On Windows, the result is a UNC path if and only
@@ -134,6 +134,17 @@ func (fs *Reader) Lstat(name string) (os.FileInfo, error) {
 	return nil, os.ErrNotExist
 }
 
+// EvalSymlinks returns the path name after the evaluation of any symbolic
+// links. There are no symbolic links in a Reader, so name is returned as is
+// if it exists.
+func (fs *Reader) EvalSymlinks(name string) (string, error) {
+	if _, err := fs.Lstat(name); err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
 // Join joins any number of path elements into a single path, adding a
 // Separator if necessary. Join calls Clean on the result; in particular, all
 // empty strings are ignored. On Windows, the result is a UNC path if and only
@@ -0,0 +1,130 @@
+// +build !netbsd
+// +build !openbsd
+// +build !solaris
+// +build !windows
+
+package fuse
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+
+	"bazil.org/fuse"
+
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func testSaveSnapshot(t testing.TB, repo restic.Repository, host string, tags []string, paths []string, at time.Time) {
+	sn, err := restic.NewSnapshot(paths, tags, host, at)
+	rtest.OK(t, err)
+
+	tree := restic.NewRandomID()
+	sn.Tree = &tree
+
+	_, err = repo.SaveJSONUnpacked(context.TODO(), restic.SnapshotFile, sn)
+	rtest.OK(t, err)
+}
+
+type dirAller interface {
+	ReadDirAll(context.Context) ([]fuse.Dirent, error)
+}
+
+// testReadDirNames returns the sorted names of the entries in d, without "."
+// and "..".
+func testReadDirNames(t testing.TB, d dirAller) []string {
+	entries, err := d.ReadDirAll(context.TODO())
+	rtest.OK(t, err)
+
+	var names []string
+	for _, e := range entries {
+		if e.Name == "." || e.Name == ".." {
+			continue
+		}
+		names = append(names, e.Name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+func TestSnapshotsDirFilter(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	at := time.Date(2018, 8, 1, 12, 0, 0, 0, time.UTC)
+	testSaveSnapshot(t, repo, "foo", []string{"daily"}, []string{"/home"}, at)
+	testSaveSnapshot(t, repo, "foo", []string{"weekly"}, []string{"/home"}, at.Add(time.Hour))
+	testSaveSnapshot(t, repo, "foo", []string{"daily"}, []string{"/etc"}, at.Add(2*time.Hour))
+	testSaveSnapshot(t, repo, "bar", []string{"daily"}, []string{"/home"}, at.Add(3*time.Hour))
+
+	var tests = []struct {
+		cfg       Config
+		snapshots int
+		hosts     []string
+		tags      []string
+	}{
+		{
+			cfg:       Config{},
+			snapshots: 4,
+			hosts:     []string{"bar", "foo"},
+			tags:      []string{"daily", "weekly"},
+		},
+		{
+			cfg:       Config{Host: "foo"},
+			snapshots: 3,
+			hosts:     []string{"foo"},
+			tags:      []string{"daily", "weekly"},
+		},
+		{
+			cfg:       Config{Tags: []restic.TagList{{"daily"}}},
+			snapshots: 3,
+			hosts:     []string{"bar", "foo"},
+			tags:      []string{"daily"},
+		},
+		{
+			cfg:       Config{Paths: []string{"/home"}},
+			snapshots: 3,
+			hosts:     []string{"bar", "foo"},
+			tags:      []string{"daily", "weekly"},
+		},
+		{
+			cfg:       Config{Host: "foo", Tags: []restic.TagList{{"daily"}}, Paths: []string{"/home"}},
+			snapshots: 1,
+			hosts:     []string{"foo"},
+			tags:      []string{"daily"},
+		},
+		{
+			cfg:       Config{Host: "baz"},
+			snapshots: 0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run("", func(t *testing.T) {
+			test.cfg.SnapshotTemplate = time.RFC3339
+			root, err := NewRoot(context.TODO(), repo, test.cfg)
+			rtest.OK(t, err)
+
+			snapshots := testReadDirNames(t, NewSnapshotsDir(root, 2, "", ""))
+			ids := testReadDirNames(t, NewSnapshotsIDSDir(root, 3))
+			hosts := testReadDirNames(t, NewHostsDir(root, 4))
+			tags := testReadDirNames(t, NewTagsDir(root, 5))
+
+			// the snapshots dir contains the "latest" link
+			if test.snapshots > 0 {
+				rtest.Equals(t, test.snapshots+1, len(snapshots))
+			} else {
+				rtest.Equals(t, 0, len(snapshots))
+			}
+			rtest.Equals(t, test.snapshots, len(ids))
+			rtest.Equals(t, test.hosts, hosts)
+			rtest.Equals(t, test.tags, tags)
+		})
+	}
+}
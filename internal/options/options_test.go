@@ -124,6 +124,7 @@ type Target struct {
 	Name    string        `option:"name"`
 	ID      int           `option:"id"`
 	Timeout time.Duration `option:"timeout"`
+	Switch  bool          `option:"switch"`
 	Other   string
 }
 
@@ -157,6 +158,14 @@ var setTests = []struct {
 			Timeout: time.Duration(10*time.Minute + 3*time.Second),
 		},
 	},
+	{
+		Options{
+			"switch": "true",
+		},
+		Target{
+			Switch: true,
+		},
+	},
 }
 
 func TestOptionsApply(t *testing.T) {
@@ -201,6 +210,13 @@ var invalidSetTests = []struct {
 		"ns",
 		`time: missing unit in duration 2134`,
 	},
+	{
+		Options{
+			"switch": "yes",
+		},
+		"ns",
+		`strconv.ParseBool: parsing "yes": invalid syntax`,
+	},
 }
 
 func TestOptionsApplyInvalid(t *testing.T) {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"math"
 	"sync"
 	"time"
 
@@ -15,10 +16,26 @@ import (
 
 // Index holds a lookup table for id -> pack.
 type Index struct {
-	m         sync.Mutex
-	pack      map[restic.BlobHandle][]indexEntry
+	m sync.Mutex
+
+	// pack holds the first entry stored for each blob in compact form, all
+	// further entries for the blob are kept in overflow
+	pack      map[restic.BlobHandle]compactEntry
+	overflow  map[restic.BlobHandle][]indexEntry
 	treePacks restic.IDs
 
+	// packs is the table of pack IDs referenced by the compact entries,
+	// packNum maps the IDs back to their position in the table
+	packs   restic.IDs
+	packNum map[restic.ID]uint32
+
+	// disk holds the entries instead of pack when the index has been moved
+	// to a temporary file, see IndexOptions
+	disk *diskIndex
+	// diskErr is the first error which occurred while reading entries from
+	// disk, see Err
+	diskErr error
+
 	final      bool      // set to true for all indexes read from the backend ("finalized")
 	id         restic.ID // set to the ID of the index when it's finalized
 	supersedes restic.IDs
@@ -31,22 +48,151 @@ type indexEntry struct {
 	length uint
 }
 
+// compactEntry is the in-memory representation of an index entry. Instead of
+// the pack ID it stores the position of the ID in the pack table of the
+// index, and offset and length are stored as uint32, which is sufficient for
+// all packs written by restic. This needs 12 instead of 48 bytes per entry
+// and avoids allocating a slice for each blob.
+type compactEntry struct {
+	pack           uint32
+	offset, length uint32
+}
+
 // NewIndex returns a new index.
 func NewIndex() *Index {
 	return &Index{
-		pack:    make(map[restic.BlobHandle][]indexEntry),
-		created: time.Now(),
+		pack:     make(map[restic.BlobHandle]compactEntry),
+		overflow: make(map[restic.BlobHandle][]indexEntry),
+		packNum:  make(map[restic.ID]uint32),
+		created:  time.Now(),
 	}
 }
 
+// addPack returns the position of id in the pack table, adding it if
+// necessary.
+func (idx *Index) addPack(id restic.ID) uint32 {
+	n, ok := idx.packNum[id]
+	if !ok {
+		n = uint32(len(idx.packs))
+		idx.packNum[id] = n
+		idx.packs = append(idx.packs, id)
+	}
+
+	return n
+}
+
 func (idx *Index) store(blob restic.PackedBlob) {
-	newEntry := indexEntry{
+	h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
+	n := idx.addPack(blob.PackID)
+
+	_, stored := idx.pack[h]
+	_, overflow := idx.overflow[h]
+	fits := blob.Offset <= math.MaxUint32 && blob.Length <= math.MaxUint32
+
+	// only the first entry for a blob is stored in compact form, so the
+	// entries are returned in the order they were added
+	if !stored && !overflow && fits {
+		idx.pack[h] = compactEntry{
+			pack:   n,
+			offset: uint32(blob.Offset),
+			length: uint32(blob.Length),
+		}
+		return
+	}
+
+	idx.overflow[h] = append(idx.overflow[h], indexEntry{
 		packID: blob.PackID,
 		offset: blob.Offset,
 		length: blob.Length,
+	})
+}
+
+func (idx *Index) indexEntry(e compactEntry) indexEntry {
+	return indexEntry{
+		packID: idx.packs[e.pack],
+		offset: uint(e.offset),
+		length: uint(e.length),
 	}
-	h := restic.BlobHandle{ID: blob.ID, Type: blob.Type}
-	idx.pack[h] = append(idx.pack[h], newEntry)
+}
+
+// setErr records the first error which occurred while reading the on-disk
+// entries.
+func (idx *Index) setErr(err error) {
+	debug.Log("error reading on-disk index: %v", err)
+	if idx.diskErr == nil {
+		idx.diskErr = err
+	}
+}
+
+// get returns all entries for the blob handle h.
+func (idx *Index) get(h restic.BlobHandle) []indexEntry {
+	if idx.disk != nil {
+		list, err := idx.disk.get(h)
+		if err != nil {
+			idx.setErr(err)
+		}
+		return list
+	}
+
+	e, ok := idx.pack[h]
+	if !ok {
+		return idx.overflow[h]
+	}
+
+	list := make([]indexEntry, 0, 1+len(idx.overflow[h]))
+	list = append(list, idx.indexEntry(e))
+	return append(list, idx.overflow[h]...)
+}
+
+// has returns true if there is at least one entry for the blob handle h.
+func (idx *Index) has(h restic.BlobHandle) bool {
+	if idx.disk != nil {
+		return len(idx.get(h)) > 0
+	}
+
+	if _, ok := idx.pack[h]; ok {
+		return true
+	}
+
+	return len(idx.overflow[h]) > 0
+}
+
+// each calls fn for all entries in the index. When fn returns false, the
+// iteration is stopped. An error is only returned for on-disk indexes.
+func (idx *Index) each(fn func(restic.BlobHandle, indexEntry) bool) error {
+	if idx.disk != nil {
+		err := idx.disk.each(fn)
+		if err != nil {
+			idx.setErr(err)
+		}
+		return err
+	}
+
+	for h, e := range idx.pack {
+		if !fn(h, idx.indexEntry(e)) {
+			return nil
+		}
+	}
+
+	for h, list := range idx.overflow {
+		for _, entry := range list {
+			if !fn(h, entry) {
+				return nil
+			}
+		}
+	}
+
+	return nil
+}
+
+// Err returns the first error which occurred while reading the entries of an
+// index which has been moved to disk. Afterwards, the results of Lookup, Has,
+// ListPack and Each may be incomplete.
+func (idx *Index) Err() error {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	return idx.diskErr
 }
 
 // Final returns true iff the index is already written to the repository, it is
@@ -116,7 +262,7 @@ func (idx *Index) Lookup(id restic.ID, tpe restic.BlobType) (blobs []restic.Pack
 
 	h := restic.BlobHandle{ID: id, Type: tpe}
 
-	if packs, ok := idx.pack[h]; ok {
+	if packs := idx.get(h); len(packs) > 0 {
 		blobs = make([]restic.PackedBlob, 0, len(packs))
 
 		for _, p := range packs {
@@ -144,21 +290,20 @@ func (idx *Index) ListPack(id restic.ID) (list []restic.PackedBlob) {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
-	for h, packList := range idx.pack {
-		for _, entry := range packList {
-			if entry.packID == id {
-				list = append(list, restic.PackedBlob{
-					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Length: entry.length,
-						Offset: entry.offset,
-					},
-					PackID: entry.packID,
-				})
-			}
+	idx.each(func(h restic.BlobHandle, entry indexEntry) bool {
+		if entry.packID == id {
+			list = append(list, restic.PackedBlob{
+				Blob: restic.Blob{
+					ID:     h.ID,
+					Type:   h.Type,
+					Length: entry.length,
+					Offset: entry.offset,
+				},
+				PackID: entry.packID,
+			})
 		}
-	}
+		return true
+	})
 
 	return list
 }
@@ -170,8 +315,7 @@ func (idx *Index) Has(id restic.ID, tpe restic.BlobType) bool {
 
 	h := restic.BlobHandle{ID: id, Type: tpe}
 
-	_, ok := idx.pack[h]
-	return ok
+	return idx.has(h)
 }
 
 // LookupSize returns the length of the plaintext content of the blob with the
@@ -218,23 +362,22 @@ func (idx *Index) Each(ctx context.Context) <-chan restic.PackedBlob {
 			close(ch)
 		}()
 
-		for h, packs := range idx.pack {
-			for _, blob := range packs {
-				select {
-				case <-ctx.Done():
-					return
-				case ch <- restic.PackedBlob{
-					Blob: restic.Blob{
-						ID:     h.ID,
-						Type:   h.Type,
-						Offset: blob.offset,
-						Length: blob.length,
-					},
-					PackID: blob.packID,
-				}:
-				}
+		idx.each(func(h restic.BlobHandle, blob indexEntry) bool {
+			select {
+			case <-ctx.Done():
+				return false
+			case ch <- restic.PackedBlob{
+				Blob: restic.Blob{
+					ID:     h.ID,
+					Type:   h.Type,
+					Offset: blob.offset,
+					Length: blob.length,
+				},
+				PackID: blob.packID,
+			}:
 			}
-		}
+			return true
+		})
 	}()
 
 	return ch
@@ -246,10 +389,15 @@ func (idx *Index) Packs() restic.IDSet {
 	defer idx.m.Unlock()
 
 	packs := restic.NewIDSet()
-	for _, list := range idx.pack {
-		for _, entry := range list {
-			packs.Insert(entry.packID)
+	if idx.disk != nil {
+		for _, id := range idx.disk.packs {
+			packs.Insert(id)
 		}
+		return packs
+	}
+
+	for _, id := range idx.packs {
+		packs.Insert(id)
 	}
 
 	return packs
@@ -261,12 +409,20 @@ func (idx *Index) Count(t restic.BlobType) (n uint) {
 	idx.m.Lock()
 	defer idx.m.Unlock()
 
-	for h, list := range idx.pack {
-		if h.Type != t {
-			continue
+	if idx.disk != nil {
+		return idx.disk.count[t]
+	}
+
+	for h := range idx.pack {
+		if h.Type == t {
+			n++
 		}
+	}
 
-		n += uint(len(list))
+	for h, list := range idx.overflow {
+		if h.Type == t {
+			n += uint(len(list))
+		}
 	}
 
 	return
@@ -289,39 +445,48 @@ func (idx *Index) generatePackList() ([]*packJSON, error) {
 	list := []*packJSON{}
 	packs := make(map[restic.ID]*packJSON)
 
-	for h, packedBlobs := range idx.pack {
-		for _, blob := range packedBlobs {
-			if blob.packID.IsNull() {
-				panic("null pack id")
-			}
-
-			debug.Log("handle blob %v", h)
+	var err error
+	eachErr := idx.each(func(h restic.BlobHandle, blob indexEntry) bool {
+		if blob.packID.IsNull() {
+			panic("null pack id")
+		}
 
-			if blob.packID.IsNull() {
-				debug.Log("blob %v has no packID! (offset %v, length %v)",
-					h, blob.offset, blob.length)
-				return nil, errors.Errorf("unable to serialize index: pack for blob %v hasn't been written yet", h)
-			}
+		debug.Log("handle blob %v", h)
 
-			// see if pack is already in map
-			p, ok := packs[blob.packID]
-			if !ok {
-				// else create new pack
-				p = &packJSON{ID: blob.packID}
+		if blob.packID.IsNull() {
+			debug.Log("blob %v has no packID! (offset %v, length %v)",
+				h, blob.offset, blob.length)
+			err = errors.Errorf("unable to serialize index: pack for blob %v hasn't been written yet", h)
+			return false
+		}
 
-				// and append it to the list and map
-				list = append(list, p)
-				packs[p.ID] = p
-			}
+		// see if pack is already in map
+		p, ok := packs[blob.packID]
+		if !ok {
+			// else create new pack
+			p = &packJSON{ID: blob.packID}
 
-			// add blob
-			p.Blobs = append(p.Blobs, blobJSON{
-				ID:     h.ID,
-				Type:   h.Type,
-				Offset: blob.offset,
-				Length: blob.length,
-			})
+			// and append it to the list and map
+			list = append(list, p)
+			packs[p.ID] = p
 		}
+
+		// add blob
+		p.Blobs = append(p.Blobs, blobJSON{
+			ID:     h.ID,
+			Type:   h.Type,
+			Offset: blob.offset,
+			Length: blob.length,
+		})
+		return true
+	})
+
+	if eachErr != nil {
+		return nil, eachErr
+	}
+
+	if err != nil {
+		return nil, err
 	}
 
 	debug.Log("done")
@@ -563,6 +728,14 @@ func LoadIndexWithDecoder(ctx context.Context, repo restic.Repository, buf []byt
 		return nil, buf[:0], err
 	}
 
+	// keep the entries in the on-disk index of the repository, if enabled
+	if r, ok := repo.(*Repository); ok && r.diskIndex != nil {
+		err = idx.moveToDisk(r.diskIndex)
+		if err != nil {
+			return nil, buf[:0], err
+		}
+	}
+
 	idx.id = id
 
 	return idx, buf, nil
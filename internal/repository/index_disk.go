@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/fs"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// IndexOptions configures how index files loaded from the repository are
+// held by the client.
+type IndexOptions struct {
+	OnDisk bool `option:"on-disk" help:"keep index entries in a temporary file instead of memory (slower, reduces the RAM needed for looking up blobs)"`
+}
+
+func init() {
+	options.Register("index", IndexOptions{})
+}
+
+// diskEntrySize is the size of an entry in the on-disk index: the blob ID,
+// the blob type and the pack number, offset and length as uint32.
+const diskEntrySize = len(restic.ID{}) + 1 + 3*4
+
+// diskIndexFile is the temporary file which holds the entries of all indexes
+// of a repository which have been moved to disk. It is removed by Close.
+type diskIndexFile struct {
+	m    sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func newDiskIndexFile() (*diskIndexFile, error) {
+	f, err := fs.TempFile("", "restic-index-")
+	if err != nil {
+		return nil, errors.Wrap(err, "TempFile")
+	}
+
+	debug.Log("using %v for the on-disk index", f.Name())
+	return &diskIndexFile{f: f}, nil
+}
+
+// append writes buf to the end of the file and returns the offset at which it
+// was written.
+func (df *diskIndexFile) append(buf []byte) (int64, error) {
+	df.m.Lock()
+	defer df.m.Unlock()
+
+	if df.f == nil {
+		return 0, errors.New("on-disk index already closed")
+	}
+
+	offset := df.size
+	n, err := df.f.WriteAt(buf, offset)
+	df.size += int64(n)
+	if err != nil {
+		return 0, errors.Wrap(err, "WriteAt")
+	}
+
+	return offset, nil
+}
+
+// Close closes and removes the file. Afterwards, all indexes stored in the
+// file cannot be used any more.
+func (df *diskIndexFile) Close() error {
+	df.m.Lock()
+	defer df.m.Unlock()
+
+	if df.f == nil {
+		return nil
+	}
+
+	name := df.f.Name()
+	err := df.f.Close()
+	df.f = nil
+
+	// on Unix, TempFile has already removed the file
+	if rerr := fs.Remove(name); rerr != nil && !os.IsNotExist(rerr) && err == nil {
+		err = rerr
+	}
+	return errors.Wrap(err, "Close")
+}
+
+// diskIndex is a read-only table of index entries stored in the on-disk index
+// file of the repository, sorted by blob ID and type. Only the list of packs
+// and a small lookup table for the first byte of the blob IDs are kept in
+// memory, the entries are read on demand and cached by the operating system.
+type diskIndex struct {
+	file  *diskIndexFile
+	start int64
+	packs restic.IDs
+	n     int
+
+	// the entries for blob IDs starting with byte b are at positions
+	// fanout[b] to fanout[b+1]-1
+	fanout [257]int
+
+	// number of entries per blob type
+	count map[restic.BlobType]uint
+}
+
+type diskEntry struct {
+	h              restic.BlobHandle
+	pack           uint32
+	offset, length uint32
+}
+
+func (e diskEntry) marshal(buf []byte) {
+	copy(buf, e.h.ID[:])
+	buf[len(e.h.ID)] = byte(e.h.Type)
+	data := buf[len(e.h.ID)+1:]
+	binary.LittleEndian.PutUint32(data[0:], e.pack)
+	binary.LittleEndian.PutUint32(data[4:], e.offset)
+	binary.LittleEndian.PutUint32(data[8:], e.length)
+}
+
+func (e *diskEntry) unmarshal(buf []byte) {
+	copy(e.h.ID[:], buf)
+	e.h.Type = restic.BlobType(buf[len(e.h.ID)])
+	data := buf[len(e.h.ID)+1:]
+	e.pack = binary.LittleEndian.Uint32(data[0:])
+	e.offset = binary.LittleEndian.Uint32(data[4:])
+	e.length = binary.LittleEndian.Uint32(data[8:])
+}
+
+func lessHandle(a, b restic.BlobHandle) bool {
+	if c := bytes.Compare(a.ID[:], b.ID[:]); c != 0 {
+		return c < 0
+	}
+	return a.Type < b.Type
+}
+
+// newDiskIndex appends all entries of idx to the on-disk index file.
+func newDiskIndex(file *diskIndexFile, idx *Index) (*diskIndex, error) {
+	d := &diskIndex{
+		file:  file,
+		count: make(map[restic.BlobType]uint),
+	}
+
+	packNum := make(map[restic.ID]uint32)
+	entries := make([]diskEntry, 0, len(idx.pack))
+
+	var err error
+	idx.each(func(h restic.BlobHandle, e indexEntry) bool {
+		if e.offset > math.MaxUint32 || e.length > math.MaxUint32 {
+			err = errors.Errorf("blob %v: offset or length too large for on-disk index", h)
+			return false
+		}
+
+		n, ok := packNum[e.packID]
+		if !ok {
+			n = uint32(len(d.packs))
+			packNum[e.packID] = n
+			d.packs = append(d.packs, e.packID)
+		}
+
+		entries = append(entries, diskEntry{h: h, pack: n, offset: uint32(e.offset), length: uint32(e.length)})
+		d.count[h.Type]++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return lessHandle(entries[i].h, entries[j].h)
+	})
+
+	buf := make([]byte, len(entries)*diskEntrySize)
+	for i, e := range entries {
+		e.marshal(buf[i*diskEntrySize:])
+	}
+
+	d.start, err = file.append(buf)
+	if err != nil {
+		return nil, err
+	}
+
+	d.n = len(entries)
+	d.buildFanout(entries)
+
+	debug.Log("wrote %d entries for %d packs at offset %d", d.n, len(d.packs), d.start)
+
+	return d, nil
+}
+
+// buildFanout fills the lookup table for the sorted entries.
+func (d *diskIndex) buildFanout(entries []diskEntry) {
+	pos := 0
+	for b := 0; b < 256; b++ {
+		d.fanout[b] = pos
+		for pos < len(entries) && int(entries[pos].h.ID[0]) == b {
+			pos++
+		}
+	}
+	d.fanout[256] = len(entries)
+}
+
+// reader returns a reader for the entries of the index. An error is returned
+// if the file has already been closed.
+func (d *diskIndex) reader() (*io.SectionReader, error) {
+	d.file.m.Lock()
+	defer d.file.m.Unlock()
+
+	if d.file.f == nil {
+		return nil, errors.New("on-disk index already closed")
+	}
+
+	return io.NewSectionReader(d.file.f, d.start, int64(d.n)*int64(diskEntrySize)), nil
+}
+
+// readEntry reads the entry at position i.
+func readEntry(rd io.ReaderAt, i int, buf []byte) (diskEntry, error) {
+	var e diskEntry
+	_, err := rd.ReadAt(buf[:diskEntrySize], int64(i)*int64(diskEntrySize))
+	if err != nil {
+		return e, errors.Wrap(err, "read on-disk index")
+	}
+
+	e.unmarshal(buf)
+	return e, nil
+}
+
+func (d *diskIndex) indexEntry(e diskEntry) indexEntry {
+	return indexEntry{
+		packID: d.packs[e.pack],
+		offset: uint(e.offset),
+		length: uint(e.length),
+	}
+}
+
+// get returns all entries for the blob handle h.
+func (d *diskIndex) get(h restic.BlobHandle) (list []indexEntry, err error) {
+	rd, err := d.reader()
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, diskEntrySize)
+	lo, hi := d.fanout[h.ID[0]], d.fanout[int(h.ID[0])+1]
+
+	var readErr error
+	i := lo + sort.Search(hi-lo, func(i int) bool {
+		if readErr != nil {
+			return true
+		}
+
+		var e diskEntry
+		e, readErr = readEntry(rd, lo+i, buf)
+		return !lessHandle(e.h, h)
+	})
+	if readErr != nil {
+		return nil, readErr
+	}
+
+	for ; i < hi; i++ {
+		e, err := readEntry(rd, i, buf)
+		if err != nil {
+			return nil, err
+		}
+		if e.h != h {
+			break
+		}
+		list = append(list, d.indexEntry(e))
+	}
+
+	return list, nil
+}
+
+// each calls fn for all entries in the order in which they are stored. When
+// fn returns false, the iteration is stopped.
+func (d *diskIndex) each(fn func(restic.BlobHandle, indexEntry) bool) error {
+	sr, err := d.reader()
+	if err != nil {
+		return err
+	}
+
+	rd := bufio.NewReader(sr)
+	buf := make([]byte, diskEntrySize)
+	for i := 0; i < d.n; i++ {
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return errors.Wrap(err, "read on-disk index")
+		}
+
+		var e diskEntry
+		e.unmarshal(buf)
+		if !fn(e.h, d.indexEntry(e)) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// moveToDisk moves all entries of the finalized index to the on-disk index
+// file.
+func (idx *Index) moveToDisk(file *diskIndexFile) error {
+	idx.m.Lock()
+	defer idx.m.Unlock()
+
+	if idx.disk != nil {
+		return nil
+	}
+
+	disk, err := newDiskIndex(file, idx)
+	if err != nil {
+		return err
+	}
+
+	idx.disk = disk
+	idx.pack = nil
+	idx.overflow = nil
+	idx.packs = nil
+	idx.packNum = nil
+	return nil
+}
@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"bytes"
+	"context"
 	"math/rand"
 	"testing"
 
@@ -490,3 +491,247 @@ func TestIndexHas(t *testing.T) {
 	rtest.Assert(t, !idx.Has(restic.NewRandomID(), restic.DataBlob), "Index reports having a data blob not added to it")
 	rtest.Assert(t, !idx.Has(tests[0].id, restic.TreeBlob), "Index reports having a tree blob added to it with the same id as a data blob")
 }
+
+func TestIndexOnDisk(t *testing.T) {
+	idx := repository.NewIndex()
+
+	var blobs []restic.PackedBlob
+	for i := 0; i < 30; i++ {
+		packID := restic.NewRandomID()
+
+		pos := uint(0)
+		for j := 0; j < 20; j++ {
+			tpe := restic.DataBlob
+			if j%5 == 0 {
+				tpe = restic.TreeBlob
+			}
+
+			blob := restic.PackedBlob{
+				Blob: restic.Blob{
+					Type:   tpe,
+					ID:     restic.NewRandomID(),
+					Offset: pos,
+					Length: uint(i*100 + j),
+				},
+				PackID: packID,
+			}
+			idx.Store(blob)
+			blobs = append(blobs, blob)
+
+			pos += blob.Length
+		}
+	}
+
+	// store a blob a second time in another pack
+	dup := blobs[0]
+	dup.PackID = restic.NewRandomID()
+	idx.Store(dup)
+
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.Finalize(wr))
+
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	rtest.OK(t, repo.(*repository.Repository).SetIndexOptions(repository.IndexOptions{OnDisk: true}))
+	defer func() {
+		rtest.OK(t, repo.(*repository.Repository).CloseIndex())
+	}()
+
+	id, err := repo.SaveUnpacked(context.TODO(), restic.IndexFile, wr.Bytes())
+	rtest.OK(t, err)
+
+	idx2, _, err := repository.LoadIndexWithDecoder(context.TODO(), repo, nil, id, repository.DecodeIndex)
+	rtest.OK(t, err)
+
+	for _, blob := range blobs {
+		list, found := idx2.Lookup(blob.ID, blob.Type)
+		rtest.Assert(t, found, "blob %v not found", blob.ID.Str())
+		rtest.Assert(t, idx2.Has(blob.ID, blob.Type), "Has() returned false for blob %v", blob.ID.Str())
+
+		want, _ := idx.Lookup(blob.ID, blob.Type)
+		rtest.Equals(t, len(want), len(list))
+		for _, pb := range want {
+			found = false
+			for _, pb2 := range list {
+				if pb == pb2 {
+					found = true
+				}
+			}
+			rtest.Assert(t, found, "entry %v not found for blob %v", pb, blob.ID.Str())
+		}
+
+		other := restic.TreeBlob
+		if blob.Type == restic.TreeBlob {
+			other = restic.DataBlob
+		}
+		rtest.Assert(t, !idx2.Has(blob.ID, other), "blob %v found with wrong type", blob.ID.Str())
+	}
+
+	rtest.Assert(t, !idx2.Has(restic.NewRandomID(), restic.DataBlob), "unknown blob found")
+
+	rtest.Equals(t, idx.Count(restic.DataBlob), idx2.Count(restic.DataBlob))
+	rtest.Equals(t, idx.Count(restic.TreeBlob), idx2.Count(restic.TreeBlob))
+	rtest.Equals(t, idx.Packs(), idx2.Packs())
+
+	list := idx2.ListPack(blobs[0].PackID)
+	rtest.Equals(t, 20, len(list))
+
+	n := 0
+	for range idx2.Each(context.TODO()) {
+		n++
+	}
+	rtest.Equals(t, len(blobs)+1, n)
+
+	// encoding the on-disk index must yield the same entries again
+	wr2 := bytes.NewBuffer(nil)
+	rtest.OK(t, idx2.Encode(wr2))
+
+	idx3, err := repository.DecodeIndex(wr2.Bytes())
+	rtest.OK(t, err)
+	rtest.Equals(t, idx.Packs(), idx3.Packs())
+	rtest.Equals(t, idx.Count(restic.DataBlob), idx3.Count(restic.DataBlob))
+	rtest.OK(t, idx2.Err())
+
+	// after the on-disk index has been closed, reading entries fails
+	rtest.OK(t, repo.(*repository.Repository).CloseIndex())
+
+	_, found := idx2.Lookup(blobs[0].ID, blobs[0].Type)
+	rtest.Assert(t, !found, "blob found in closed on-disk index")
+	rtest.Assert(t, idx2.Err() != nil, "no error reported for closed on-disk index")
+
+	rtest.Assert(t, idx2.Encode(bytes.NewBuffer(nil)) != nil, "encoding closed on-disk index succeeded")
+
+	// rebuilding must not silently drop the entries which cannot be read
+	mi := repository.NewMasterIndex()
+	mi.Insert(idx2)
+	rtest.Assert(t, mi.Err() != nil, "no error reported by master index")
+	_, err = mi.RebuildIndex(restic.NewIDSet())
+	rtest.Assert(t, err != nil, "rebuilding closed on-disk index succeeded")
+}
+
+func TestIndexDuplicateBlobs(t *testing.T) {
+	idx := repository.NewIndex()
+
+	id := restic.NewRandomID()
+	var want []restic.PackedBlob
+	for i := 0; i < 3; i++ {
+		blob := restic.PackedBlob{
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     id,
+				Offset: uint(i * 100),
+				Length: uint(i*10 + 42),
+			},
+			PackID: restic.NewRandomID(),
+		}
+		idx.Store(blob)
+		want = append(want, blob)
+	}
+
+	// entries are returned in the order they were stored
+	list, found := idx.Lookup(id, restic.DataBlob)
+	rtest.Assert(t, found, "blob %v not found", id.Str())
+	rtest.Equals(t, want, list)
+
+	rtest.Equals(t, uint(3), idx.Count(restic.DataBlob))
+	rtest.Equals(t, uint(0), idx.Count(restic.TreeBlob))
+	rtest.Equals(t, 3, len(idx.Packs()))
+
+	for _, blob := range want {
+		rtest.Equals(t, []restic.PackedBlob{blob}, idx.ListPack(blob.PackID))
+	}
+
+	n := 0
+	for range idx.Each(context.TODO()) {
+		n++
+	}
+	rtest.Equals(t, 3, n)
+}
+
+func TestIndexLargeOffset(t *testing.T) {
+	if ^uint(0)>>32 == 0 {
+		t.Skip("uint is 32 bit")
+	}
+
+	idx := repository.NewIndex()
+
+	// offsets which do not fit into 32 bit are stored as well
+	large := uint64(1) << 33
+	blobs := []restic.PackedBlob{
+		{
+			Blob:   restic.Blob{Type: restic.DataBlob, ID: restic.NewRandomID(), Offset: uint(large), Length: 23},
+			PackID: restic.NewRandomID(),
+		},
+		{
+			Blob:   restic.Blob{Type: restic.TreeBlob, ID: restic.NewRandomID(), Offset: 0, Length: uint(large)},
+			PackID: restic.NewRandomID(),
+		},
+	}
+
+	for _, blob := range blobs {
+		idx.Store(blob)
+	}
+
+	for _, blob := range blobs {
+		list, found := idx.Lookup(blob.ID, blob.Type)
+		rtest.Assert(t, found, "blob %v not found", blob.ID.Str())
+		rtest.Equals(t, []restic.PackedBlob{blob}, list)
+	}
+
+	wr := bytes.NewBuffer(nil)
+	rtest.OK(t, idx.Finalize(wr))
+
+	idx2, err := repository.DecodeIndex(wr.Bytes())
+	rtest.OK(t, err)
+
+	for _, blob := range blobs {
+		list, found := idx2.Lookup(blob.ID, blob.Type)
+		rtest.Assert(t, found, "blob %v not found", blob.ID.Str())
+		rtest.Equals(t, []restic.PackedBlob{blob}, list)
+	}
+}
+
+func BenchmarkIndexStore(b *testing.B) {
+	rng := rand.New(rand.NewSource(0))
+	packID := NewRandomTestID(rng)
+
+	blobs := make([]restic.PackedBlob, b.N)
+	for i := range blobs {
+		if i%1000 == 0 {
+			packID = NewRandomTestID(rng)
+		}
+
+		blobs[i] = restic.PackedBlob{
+			PackID: packID,
+			Blob: restic.Blob{
+				Type:   restic.DataBlob,
+				ID:     NewRandomTestID(rng),
+				Length: 4096,
+				Offset: uint(i%1000) * 4096,
+			},
+		}
+	}
+
+	idx := repository.NewIndex()
+
+	// the reported allocated bytes per operation are roughly the memory
+	// needed by the index per blob
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for _, blob := range blobs {
+		idx.Store(blob)
+	}
+}
+
+func BenchmarkIndexLookupKnown(b *testing.B) {
+	idx, lookupID := createRandomIndex(rand.New(rand.NewSource(0)))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		idx.Lookup(lookupID, restic.DataBlob)
+	}
+}
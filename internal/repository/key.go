@@ -37,28 +37,41 @@ type Key struct {
 	Salt []byte `json:"salt"`
 	Data []byte `json:"data"`
 
+	// ReadOnly is set for restore-only keys, it is also stored in the
+	// encrypted data so that it cannot be removed without the password.
+	ReadOnly bool `json:"read_only,omitempty"`
+
 	user   *crypto.Key
 	master *crypto.Key
 
 	name string
 }
 
+// keyData is the plaintext of the data stored in a key file. Older versions
+// of restic only decode the master key and ignore the other fields.
+type keyData struct {
+	*crypto.Key
+	ReadOnly bool `json:"read_only,omitempty"`
+}
+
 // Params tracks the parameters used for the KDF. If not set, it will be
 // calibrated on the first run of AddKey().
 var Params *crypto.Params
 
 var (
-	// KDFTimeout specifies the maximum runtime for the KDF.
-	KDFTimeout = 500 * time.Millisecond
+	// KDFTimeout specifies the maximum runtime for the KDF. The parameters
+	// are calibrated so that deriving a key takes between about half of
+	// KDFTimeout and KDFTimeout on the current machine.
+	KDFTimeout = time.Second
 
-	// KDFMemory limits the memory the KDF is allowed to use.
+	// KDFMemory limits the memory (in MiB) the KDF is allowed to use.
 	KDFMemory = 60
 )
 
 // createMasterKey creates a new master key in the given backend and encrypts
 // it with the password.
 func createMasterKey(s *Repository, password string) (*Key, error) {
-	return AddKey(context.TODO(), s, password, nil)
+	return AddKey(context.TODO(), s, password, nil, false)
 }
 
 // OpenKey tries do decrypt the key specified by name with the given password.
@@ -93,14 +106,18 @@ func OpenKey(ctx context.Context, s *Repository, name string, password string) (
 	}
 
 	// restore json
-	k.master = &crypto.Key{}
-	err = json.Unmarshal(buf, k.master)
+	data := keyData{Key: &crypto.Key{}}
+	err = json.Unmarshal(buf, &data)
 	if err != nil {
 		debug.Log("Unmarshal() returned error %v", err)
 		return nil, errors.Wrap(err, "Unmarshal")
 	}
+	k.master = data.Key
 	k.name = name
 
+	// the key is restore-only if it is marked as such in either place
+	k.ReadOnly = k.ReadOnly || data.ReadOnly
+
 	if !k.Valid() {
 		return nil, errors.New("Invalid key for repository")
 	}
@@ -198,8 +215,10 @@ func LoadKey(ctx context.Context, s *Repository, name string) (k *Key, err error
 	return k, nil
 }
 
-// AddKey adds a new key to an already existing repository.
-func AddKey(ctx context.Context, s *Repository, password string, template *crypto.Key) (*Key, error) {
+// AddKey adds a new key to an already existing repository. If readOnly is
+// set, the new key is a restore-only key: it can be used to read the
+// repository, but the client refuses to modify the repository with it.
+func AddKey(ctx context.Context, s *Repository, password string, template *crypto.Key, readOnly bool) (*Key, error) {
 	// make sure we have valid KDF parameters
 	if Params == nil {
 		p, err := crypto.Calibrate(KDFTimeout, KDFMemory)
@@ -218,6 +237,8 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 		N:       Params.N,
 		R:       Params.R,
 		P:       Params.P,
+
+		ReadOnly: readOnly,
 	}
 
 	hn, err := os.Hostname()
@@ -251,7 +272,7 @@ func AddKey(ctx context.Context, s *Repository, password string, template *crypt
 	}
 
 	// encrypt master keys (as json) with user key
-	buf, err := json.Marshal(newkey.master)
+	buf, err := json.Marshal(keyData{Key: newkey.master, ReadOnly: readOnly})
 	if err != nil {
 		return nil, errors.Wrap(err, "Marshal")
 	}
@@ -65,7 +65,24 @@ func (mi *MasterIndex) ListPack(id restic.ID) (list []restic.PackedBlob) {
 	return nil
 }
 
-// Has queries all known Indexes for the ID and returns the first match.
+// Err returns the first error which occurred while reading the entries of an
+// index which has been moved to disk, see Index.Err.
+func (mi *MasterIndex) Err() error {
+	mi.idxMutex.RLock()
+	defer mi.idxMutex.RUnlock()
+
+	for _, idx := range mi.idx {
+		if err := idx.Err(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Has queries all known Indexes for the ID and returns the first match. If
+// false is returned, Err must be checked to make sure that the blob is really
+// not contained in the index.
 func (mi *MasterIndex) Has(id restic.ID, tpe restic.BlobType) bool {
 	mi.idxMutex.RLock()
 	defer mi.idxMutex.RUnlock()
@@ -183,7 +200,8 @@ func (mi *MasterIndex) All() []*Index {
 
 // Each returns a channel that yields all blobs known to the index. When the
 // context is cancelled, the background goroutine terminates. This blocks any
-// modification of the index.
+// modification of the index. Afterwards, Err must be checked to make sure that
+// all blobs were returned.
 func (mi *MasterIndex) Each(ctx context.Context) <-chan restic.PackedBlob {
 	mi.idxMutex.RLock()
 
@@ -235,6 +253,11 @@ func (mi *MasterIndex) RebuildIndex(packBlacklist restic.IDSet) (*Index, error)
 			newIndex.Store(pb)
 		}
 
+		// do not write an index with entries missing
+		if err := idx.Err(); err != nil {
+			return nil, err
+		}
+
 		if !idx.Final() {
 			debug.Log("index %d isn't final, don't add to supersedes field", i)
 			continue
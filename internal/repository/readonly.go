@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// ErrReadOnlyKey is returned when a file should be created or removed in a
+// repository which was opened with a restore-only key.
+var ErrReadOnlyKey = errors.Fatal("the repository was opened with a restore-only key, modifying it is not allowed")
+
+// readOnlyBackend wraps a backend and refuses to create or remove files other
+// than locks. Lock files can still be created so that commands can coordinate
+// with other clients accessing the repository, but only the locks created
+// through this backend can be removed again.
+type readOnlyBackend struct {
+	restic.Backend
+
+	m     sync.Mutex
+	locks map[string]struct{}
+}
+
+// statically ensure that readOnlyBackend implements restic.Backend.
+var _ restic.Backend = &readOnlyBackend{}
+
+func newReadOnlyBackend(be restic.Backend) *readOnlyBackend {
+	return &readOnlyBackend{
+		Backend: be,
+		locks:   make(map[string]struct{}),
+	}
+}
+
+// Save stores the data in the backend under the given handle.
+func (be *readOnlyBackend) Save(ctx context.Context, h restic.Handle, rd restic.RewindReader) error {
+	if h.Type != restic.LockFile {
+		debug.Log("refusing to save %v with restore-only key", h)
+		return ErrReadOnlyKey
+	}
+
+	err := be.Backend.Save(ctx, h, rd)
+	if err != nil {
+		return err
+	}
+
+	be.m.Lock()
+	be.locks[h.Name] = struct{}{}
+	be.m.Unlock()
+
+	return nil
+}
+
+// Remove removes the file specified by h. Only locks which were created
+// through this backend can be removed.
+func (be *readOnlyBackend) Remove(ctx context.Context, h restic.Handle) error {
+	be.m.Lock()
+	_, ok := be.locks[h.Name]
+	be.m.Unlock()
+
+	if h.Type != restic.LockFile || !ok {
+		debug.Log("refusing to remove %v with restore-only key", h)
+		return ErrReadOnlyKey
+	}
+
+	err := be.Backend.Remove(ctx, h)
+	if err != nil {
+		return err
+	}
+
+	be.m.Lock()
+	delete(be.locks, h.Name)
+	be.m.Unlock()
+
+	return nil
+}
+
+// Delete removes all data in the backend.
+func (be *readOnlyBackend) Delete(ctx context.Context) error {
+	return ErrReadOnlyKey
+}
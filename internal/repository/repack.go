@@ -2,113 +2,148 @@ package repository
 
 import (
 	"context"
-	"fmt"
-	"os"
+	"io"
+	"io/ioutil"
+	"sort"
 
 	"github.com/restic/restic/internal/debug"
 	"github.com/restic/restic/internal/errors"
-	"github.com/restic/restic/internal/fs"
-	"github.com/restic/restic/internal/pack"
 	"github.com/restic/restic/internal/restic"
 )
 
 // Repack takes a list of packs together with a list of blobs contained in
-// these packs. Each pack is loaded and the blobs listed in keepBlobs is saved
-// into a new pack. Returned is the list of obsolete packs which can then
-// be removed.
+// these packs. For each pack, the header is read and the blobs listed in
+// keepBlobs are streamed from the backend and saved into a new pack. Returned
+// is the list of obsolete packs which can then be removed.
 func Repack(ctx context.Context, repo restic.Repository, packs restic.IDSet, keepBlobs restic.BlobSet, p *restic.Progress) (obsoletePacks restic.IDSet, err error) {
 	debug.Log("repacking %d packs while keeping %d blobs", len(packs), len(keepBlobs))
 
 	for packID := range packs {
-		// load the complete pack into a temp file
 		h := restic.Handle{Type: restic.DataFile, Name: packID.String()}
 
-		tempfile, hash, packLength, err := DownloadAndHash(ctx, repo.Backend(), h)
+		fi, err := repo.Backend().Stat(ctx, h)
 		if err != nil {
-			return nil, errors.Wrap(err, "Repack")
-		}
-
-		debug.Log("pack %v loaded (%d bytes), hash %v", packID, packLength, hash)
-
-		if !packID.Equal(hash) {
-			return nil, errors.Errorf("hash does not match id: want %v, got %v", packID, hash)
-		}
-
-		_, err = tempfile.Seek(0, 0)
-		if err != nil {
-			return nil, errors.Wrap(err, "Seek")
+			return nil, errors.Wrap(err, "Stat")
 		}
 
-		blobs, err := pack.List(repo.Key(), tempfile, packLength)
+		blobs, _, err := repo.ListPack(ctx, packID, fi.Size)
 		if err != nil {
 			return nil, err
 		}
 
-		debug.Log("processing pack %v, blobs: %v", packID, len(blobs))
-		var buf []byte
+		// collect the blobs we need to keep, in the order they are stored
+		var keep []restic.Blob
+		seen := restic.NewBlobSet()
 		for _, entry := range blobs {
 			h := restic.BlobHandle{ID: entry.ID, Type: entry.Type}
-			if !keepBlobs.Has(h) {
+			if !keepBlobs.Has(h) || seen.Has(h) {
 				continue
 			}
+			seen.Insert(h)
+			keep = append(keep, entry)
+		}
+
+		sort.Slice(keep, func(i, j int) bool {
+			return keep[i].Offset < keep[j].Offset
+		})
+
+		debug.Log("processing pack %v, blobs: %v, keep %v", packID, len(blobs), len(keep))
+
+		err = streamPackBlobs(ctx, repo, h, keep, func(entry restic.Blob, plaintext []byte) error {
+			_, err := repo.SaveBlob(ctx, entry.Type, plaintext, entry.ID)
+			if err != nil {
+				return err
+			}
+
+			debug.Log("  saved blob %v", entry.ID)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "Repack")
+		}
+
+		for h := range seen {
+			keepBlobs.Delete(h)
+		}
+
+		if p != nil {
+			p.Report(restic.Stat{Blobs: 1})
+		}
+	}
+
+	if err := repo.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return packs, nil
+}
+
+// streamPackBlobs loads the part of the pack h which contains the blobs with
+// a single request, decrypts the blobs while reading and calls fn with the
+// plaintext of each blob. The blobs must be sorted by offset. The data of a
+// blob is only valid until fn returns. If the backend retries the request, fn
+// is not called again for blobs which have already been processed.
+func streamPackBlobs(ctx context.Context, repo restic.Repository, h restic.Handle, blobs []restic.Blob, fn func(restic.Blob, []byte) error) error {
+	if len(blobs) == 0 {
+		return nil
+	}
 
-			debug.Log("  process blob %v", h)
+	start := blobs[0].Offset
+	last := blobs[len(blobs)-1]
+	length := last.Offset + last.Length - start
+
+	key := repo.Key()
+	done := 0
+	var buf []byte
+
+	return repo.Backend().Load(ctx, h, int(length), int64(start), func(rd io.Reader) error {
+		pos := start
+		for i, entry := range blobs {
+			// skip data of blobs which are not needed
+			if entry.Offset > pos {
+				_, err := io.CopyN(ioutil.Discard, rd, int64(entry.Offset-pos))
+				if err != nil {
+					return errors.Wrap(err, "skip")
+				}
+			}
 
-			buf = buf[:]
-			if uint(len(buf)) < entry.Length {
+			if uint(cap(buf)) < entry.Length {
 				buf = make([]byte, entry.Length)
 			}
 			buf = buf[:entry.Length]
 
-			n, err := tempfile.ReadAt(buf, int64(entry.Offset))
+			_, err := io.ReadFull(rd, buf)
 			if err != nil {
-				return nil, errors.Wrap(err, "ReadAt")
+				return errors.Wrap(err, "ReadFull")
 			}
+			pos = entry.Offset + entry.Length
 
-			if n != len(buf) {
-				return nil, errors.Errorf("read blob %v from %v: not enough bytes read, want %v, got %v",
-					h, tempfile.Name(), len(buf), n)
+			if i < done {
+				// already processed in a previous attempt
+				continue
 			}
 
-			nonce, ciphertext := buf[:repo.Key().NonceSize()], buf[repo.Key().NonceSize():]
-			plaintext, err := repo.Key().Open(ciphertext[:0], nonce, ciphertext, nil)
+			nonce, ciphertext := buf[:key.NonceSize()], buf[key.NonceSize():]
+			plaintext, err := key.Open(ciphertext[:0], nonce, ciphertext, nil)
 			if err != nil {
-				return nil, err
+				return errors.Errorf("decrypting blob %v from %v failed: %v", entry.ID.Str(), h, err)
 			}
 
 			id := restic.Hash(plaintext)
 			if !id.Equal(entry.ID) {
 				debug.Log("read blob %v/%v from %v: wrong data returned, hash is %v",
-					h.Type, h.ID, tempfile.Name(), id)
-				fmt.Fprintf(os.Stderr, "read blob %v from %v: wrong data returned, hash is %v",
-					h, tempfile.Name(), id)
+					entry.Type, entry.ID, h, id)
+				return errors.Errorf("read blob %v from %v: wrong data returned, hash is %v",
+					entry.ID.Str(), h, id.Str())
 			}
 
-			_, err = repo.SaveBlob(ctx, entry.Type, plaintext, entry.ID)
+			err = fn(entry, plaintext)
 			if err != nil {
-				return nil, err
+				return err
 			}
-
-			debug.Log("  saved blob %v", entry.ID)
-
-			keepBlobs.Delete(h)
+			done = i + 1
 		}
 
-		if err = tempfile.Close(); err != nil {
-			return nil, errors.Wrap(err, "Close")
-		}
-
-		if err = fs.RemoveIfExists(tempfile.Name()); err != nil {
-			return nil, errors.Wrap(err, "Remove")
-		}
-		if p != nil {
-			p.Report(restic.Stat{Blobs: 1})
-		}
-	}
-
-	if err := repo.Flush(ctx); err != nil {
-		return nil, err
-	}
-
-	return packs, nil
+		return nil
+	})
 }
@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/restic/restic/internal/backend/mem"
+	"github.com/restic/restic/internal/errors"
 	"github.com/restic/restic/internal/index"
 	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
@@ -251,3 +253,85 @@ func TestRepack(t *testing.T) {
 		}
 	}
 }
+
+// flakyBackend aborts the first attempt of each request for a data file after
+// half of the data has been read, like a connection failure during a download
+// which is then retried.
+type flakyBackend struct {
+	restic.Backend
+}
+
+func (be flakyBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type != restic.DataFile || length == 0 {
+		return be.Backend.Load(ctx, h, length, offset, fn)
+	}
+
+	err := be.Backend.Load(ctx, h, length, offset, func(rd io.Reader) error {
+		err := fn(io.LimitReader(rd, int64(length/2)))
+		if err == nil {
+			return errors.New("first attempt did not fail")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestRepackRetry(t *testing.T) {
+	be := flakyBackend{Backend: mem.New()}
+	repo, cleanup := repository.TestRepositoryWithBackend(t, be)
+	defer cleanup()
+
+	createRandomBlobs(t, repo, 100, 0.7)
+	saveIndex(t, repo)
+
+	removeBlobs, keepBlobs := selectBlobs(t, repo, 0.2)
+	removePacks := findPacksForBlobs(t, repo, removeBlobs)
+
+	keep := restic.NewBlobSet()
+	for h := range keepBlobs {
+		list, _ := repo.Index().Lookup(h.ID, h.Type)
+		if removePacks.Has(list[0].PackID) {
+			keep.Insert(h)
+		}
+	}
+
+	packsBefore := listPacks(t, repo)
+	repack(t, repo, removePacks, keepBlobs)
+
+	// all repacked blobs must have been saved exactly once
+	saved := make(map[restic.BlobHandle]int)
+	for id := range listPacks(t, repo) {
+		if packsBefore.Has(id) {
+			continue
+		}
+
+		h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+		fi, err := repo.Backend().Stat(context.TODO(), h)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		blobs, _, err := repo.ListPack(context.TODO(), id, fi.Size)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, blob := range blobs {
+			saved[restic.BlobHandle{ID: blob.ID, Type: blob.Type}]++
+		}
+	}
+
+	for h := range keep {
+		if saved[h] != 1 {
+			t.Errorf("blob %v was saved %d times, want 1", h, saved[h])
+		}
+	}
+
+	if len(saved) != len(keep) {
+		t.Errorf("wrong number of blobs saved, want %d, got %d", len(keep), len(saved))
+	}
+}
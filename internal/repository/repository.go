@@ -22,15 +22,22 @@ import (
 
 // Repository is used to access a repository in a backend.
 type Repository struct {
-	be      restic.Backend
-	cfg     restic.Config
-	key     *crypto.Key
-	keyName string
-	idx     *MasterIndex
+	be       restic.Backend
+	cfg      restic.Config
+	key      *crypto.Key
+	keyName  string
+	readOnly bool
+	idx      *MasterIndex
 	restic.Cache
 
 	treePM *packerManager
 	dataPM *packerManager
+
+	trees *treeCache
+
+	// diskIndex holds the entries of all loaded indexes if the on-disk index
+	// has been enabled with SetIndexOptions
+	diskIndex *diskIndexFile
 }
 
 // New returns a new repository with backend be.
@@ -40,6 +47,7 @@ func New(be restic.Backend) *Repository {
 		idx:    NewMasterIndex(),
 		dataPM: newPackerManager(be, nil),
 		treePM: newPackerManager(be, nil),
+		trees:  newTreeCache(defaultTreeCacheSize),
 	}
 
 	return repo
@@ -50,6 +58,39 @@ func (r *Repository) Config() restic.Config {
 	return r.cfg
 }
 
+// SetIndexOptions configures how index files which are loaded afterwards are
+// stored. If the on-disk index is enabled, a temporary file is created which
+// is removed by CloseIndex.
+func (r *Repository) SetIndexOptions(opts IndexOptions) error {
+	if !opts.OnDisk || r.diskIndex != nil {
+		return nil
+	}
+
+	f, err := newDiskIndexFile()
+	if err != nil {
+		return err
+	}
+
+	r.diskIndex = f
+	return nil
+}
+
+// SetTreeCacheOptions replaces the cache for decoded trees with a new one
+// configured by opts.
+func (r *Repository) SetTreeCacheOptions(opts TreeCacheOptions) {
+	r.trees = newTreeCache(int(opts.Size) << 20)
+}
+
+// CloseIndex removes the temporary file used for the on-disk index, if any.
+// Indexes which have been loaded before cannot be used afterwards.
+func (r *Repository) CloseIndex() error {
+	if r.diskIndex == nil {
+		return nil
+	}
+
+	return r.diskIndex.Close()
+}
+
 // UseCache replaces the backend with the wrapped cache.
 func (r *Repository) UseCache(c restic.Cache) {
 	if c == nil {
@@ -135,6 +176,9 @@ func (r *Repository) loadBlob(ctx context.Context, id restic.ID, t restic.BlobTy
 	blobs, found := r.idx.Lookup(id, t)
 	if !found {
 		debug.Log("id %v not found in index", id)
+		if err := r.idx.Err(); err != nil {
+			return 0, err
+		}
 		return 0, errors.Errorf("id %v not found in repository", id)
 	}
 
@@ -274,6 +318,11 @@ func (r *Repository) SaveAndEncrypt(ctx context.Context, t restic.BlobType, data
 // backend as type t, without a pack. It returns the storage hash.
 func (r *Repository) SaveJSONUnpacked(ctx context.Context, t restic.FileType, item interface{}) (restic.ID, error) {
 	debug.Log("save new blob %v", t)
+	if lock, ok := item.(*restic.Lock); ok && lock.Exclusive && r.readOnly {
+		debug.Log("refusing to create exclusive lock with restore-only key")
+		return restic.ID{}, ErrReadOnlyKey
+	}
+
 	plaintext, err := json.Marshal(item)
 	if err != nil {
 		return restic.ID{}, errors.Wrap(err, "json.Marshal")
@@ -580,6 +629,15 @@ func (r *Repository) SearchKey(ctx context.Context, password string, maxKeys int
 	r.dataPM.key = key.master
 	r.treePM.key = key.master
 	r.keyName = key.Name()
+
+	if key.ReadOnly {
+		debug.Log("key %v is restore-only", key.Name())
+		r.readOnly = true
+		r.be = newReadOnlyBackend(r.be)
+		r.dataPM.be = r.be
+		r.treePM.be = r.be
+	}
+
 	r.cfg, err = restic.LoadConfig(ctx, r)
 	if err != nil {
 		return errors.Fatalf("config cannot be loaded: %v", err)
@@ -633,6 +691,11 @@ func (r *Repository) KeyName() string {
 	return r.keyName
 }
 
+// ReadOnly returns true if the repository was opened with a restore-only key.
+func (r *Repository) ReadOnly() bool {
+	return r.readOnly
+}
+
 // List runs fn for all files of type t in the repo.
 func (r *Repository) List(ctx context.Context, t restic.FileType, fn func(restic.ID, int64) error) error {
 	return r.be.List(ctx, t, func(fi restic.FileInfo) error {
@@ -676,6 +739,9 @@ func (r *Repository) LoadBlob(ctx context.Context, t restic.BlobType, id restic.
 	debug.Log("load blob %v into buf (len %v, cap %v)", id, len(buf), cap(buf))
 	size, found := r.idx.LookupSize(id, t)
 	if !found {
+		if err := r.idx.Err(); err != nil {
+			return 0, err
+		}
 		return 0, errors.Errorf("id %v not found in repository", id)
 	}
 
@@ -704,12 +770,21 @@ func (r *Repository) SaveBlob(ctx context.Context, t restic.BlobType, buf []byte
 	return r.SaveAndEncrypt(ctx, t, buf, i)
 }
 
-// LoadTree loads a tree from the repository.
+// LoadTree loads a tree from the repository. Recently used trees are kept in
+// a cache, the returned tree is a copy and may be modified by the caller.
 func (r *Repository) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree, error) {
 	debug.Log("load tree %v", id)
 
+	if t, ok := r.trees.Get(id); ok {
+		debug.Log("tree %v found in cache", id)
+		return t, nil
+	}
+
 	size, found := r.idx.LookupSize(id, restic.TreeBlob)
 	if !found {
+		if err := r.idx.Err(); err != nil {
+			return nil, err
+		}
 		return nil, errors.Errorf("tree %v not found in repository", id)
 	}
 
@@ -728,6 +803,8 @@ func (r *Repository) LoadTree(ctx context.Context, id restic.ID) (*restic.Tree,
 		return nil, err
 	}
 
+	r.trees.Add(id, t, n)
+
 	return t, nil
 }
 
@@ -748,6 +825,9 @@ func (r *Repository) SaveTree(ctx context.Context, t *restic.Tree) (restic.ID, e
 	if r.idx.Has(id, restic.TreeBlob) {
 		return id, nil
 	}
+	if err := r.idx.Err(); err != nil {
+		return restic.ID{}, err
+	}
 
 	_, err = r.SaveBlob(ctx, restic.TreeBlob, buf, id)
 	return id, err
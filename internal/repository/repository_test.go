@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/json"
 	"io"
 	"math/rand"
 	"path/filepath"
@@ -498,3 +499,71 @@ func TestDownloadAndHashErrors(t *testing.T) {
 		})
 	}
 }
+
+func TestReadOnlyKey(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	r, cleanup := repository.TestRepositoryWithBackend(t, be)
+	defer cleanup()
+	repo := r.(*repository.Repository)
+
+	data := rtest.Random(23, 10*1024)
+	id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, data, restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	rtest.OK(t, repo.SaveIndex(context.TODO()))
+
+	key, err := repository.AddKey(context.TODO(), repo, "restore-only", repo.Key(), true)
+	rtest.OK(t, err)
+	rtest.Assert(t, key.ReadOnly, "new key is not marked as restore-only")
+
+	// remove the flag from the unencrypted part of the key file
+	k, err := repository.LoadKey(context.TODO(), repo, key.Name())
+	rtest.OK(t, err)
+	k.ReadOnly = false
+	buf, err := json.Marshal(k)
+	rtest.OK(t, err)
+	h := restic.Handle{Type: restic.KeyFile, Name: restic.Hash(buf).String()}
+	rtest.OK(t, be.Save(context.TODO(), h, restic.NewByteReader(buf)))
+	rtest.OK(t, be.Remove(context.TODO(), restic.Handle{Type: restic.KeyFile, Name: key.Name()}))
+
+	for _, hint := range []string{"", h.Name} {
+		ro := repository.New(be)
+		rtest.OK(t, ro.SearchKey(context.TODO(), "restore-only", 0, hint))
+		rtest.Assert(t, ro.ReadOnly(), "repository opened with restore-only key is not read-only")
+		rtest.OK(t, ro.LoadIndex(context.TODO()))
+
+		buf := restic.NewBlobBuffer(len(data))
+		n, err := ro.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(data, buf[:n]), "wrong data returned")
+
+		_, err = ro.SaveJSONUnpacked(context.TODO(), restic.SnapshotFile, "foo")
+		rtest.Assert(t, err == repository.ErrReadOnlyKey, "expected ErrReadOnlyKey, got %v", err)
+
+		err = ro.Backend().Remove(context.TODO(), restic.Handle{Type: restic.KeyFile, Name: h.Name})
+		rtest.Assert(t, err == repository.ErrReadOnlyKey, "expected ErrReadOnlyKey, got %v", err)
+
+		lock, err := restic.NewLock(context.TODO(), ro)
+		rtest.OK(t, err)
+		rtest.OK(t, lock.Unlock())
+
+		_, err = restic.NewExclusiveLock(context.TODO(), ro)
+		rtest.Assert(t, err == repository.ErrReadOnlyKey, "expected ErrReadOnlyKey, got %v", err)
+	}
+
+	// locks of other processes cannot be removed with the restore-only key
+	lock, err := restic.NewLock(context.TODO(), repo)
+	rtest.OK(t, err)
+
+	ro := repository.New(be)
+	rtest.OK(t, ro.SearchKey(context.TODO(), "restore-only", 0, ""))
+	err = restic.RemoveAllLocks(context.TODO(), ro)
+	rtest.Assert(t, err == repository.ErrReadOnlyKey, "expected ErrReadOnlyKey, got %v", err)
+	rtest.OK(t, lock.Unlock())
+
+	// the original key can still modify the repository
+	_, err = repo.SaveJSONUnpacked(context.TODO(), restic.SnapshotFile, "foo")
+	rtest.OK(t, err)
+}
@@ -0,0 +1,215 @@
+package repository
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// SalvageStats contains statistics about the blobs processed by Salvage.
+type SalvageStats struct {
+	// Blobs is the number of blobs the index lists for the damaged packs.
+	Blobs int
+	// Salvaged is the number of blobs which were saved into new packs.
+	Salvaged int
+	// Duplicate is the number of blobs which are also stored in an intact
+	// pack and did not need to be salvaged.
+	Duplicate int
+	// Lost contains the blobs which could not be recovered.
+	Lost restic.BlobSet
+}
+
+// Salvage reads the damaged packs, extracts all blobs which can still be
+// decrypted and match their ID and saves them into new packs. Afterwards a new
+// index is written which no longer references the damaged packs, it supersedes
+// all existing index files. The damaged packs themselves are not removed.
+//
+// Each pack must be readable completely, otherwise Salvage aborts before the
+// index is modified.
+//
+// The blobs contained in a pack are taken from the index, so blobs can be
+// salvaged even when the pack header was lost because the pack is truncated.
+func Salvage(ctx context.Context, repo *Repository, packs restic.IDSet) (SalvageStats, error) {
+	debug.Log("salvaging %d packs", len(packs))
+
+	stats := SalvageStats{Lost: restic.NewBlobSet()}
+	saved := restic.NewBlobSet()
+
+	for packID := range packs {
+		if ctx.Err() != nil {
+			return stats, ctx.Err()
+		}
+
+		blobs := repo.idx.ListPack(packID)
+		sort.Slice(blobs, func(i, j int) bool {
+			return blobs[i].Offset < blobs[j].Offset
+		})
+		stats.Blobs += len(blobs)
+
+		data, err := loadDamagedPack(ctx, repo, packID)
+		if err != nil {
+			return stats, err
+		}
+		debug.Log("pack %v: %d bytes readable, %d blobs in index", packID, len(data), len(blobs))
+
+		for _, pb := range blobs {
+			h := restic.BlobHandle{ID: pb.ID, Type: pb.Type}
+			if saved.Has(h) {
+				stats.Duplicate++
+				continue
+			}
+
+			if hasIntactCopy(repo, h, packs) {
+				debug.Log("  blob %v is stored in an intact pack", h)
+				stats.Duplicate++
+				continue
+			}
+
+			plaintext, err := decryptPackedBlob(repo, data, pb)
+			if err != nil {
+				debug.Log("  blob %v is lost: %v", h, err)
+				stats.Lost.Insert(h)
+				continue
+			}
+
+			_, err = repo.SaveBlob(ctx, pb.Type, plaintext, pb.ID)
+			if err != nil {
+				return stats, err
+			}
+
+			debug.Log("  salvaged blob %v", h)
+			saved.Insert(h)
+			stats.Lost.Delete(h)
+			stats.Salvaged++
+		}
+	}
+
+	if err := repo.Flush(ctx); err != nil {
+		return stats, err
+	}
+
+	return stats, replaceIndex(ctx, repo, packs)
+}
+
+// loadDamagedPack returns the complete content of the pack. The blobs which
+// are damaged are detected when they are decrypted.
+func loadDamagedPack(ctx context.Context, repo *Repository, id restic.ID) ([]byte, error) {
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+
+	fi, err := repo.Backend().Stat(ctx, h)
+	if err != nil {
+		return nil, errors.Wrapf(err, "pack %v", id.Str())
+	}
+
+	var data []byte
+	err = repo.Backend().Load(ctx, h, 0, 0, func(rd io.Reader) error {
+		var err error
+		data, err = ioutil.ReadAll(rd)
+		return err
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "pack %v", id.Str())
+	}
+
+	if int64(len(data)) != fi.Size {
+		return nil, errors.Errorf("pack %v: read %d bytes, expected %d", id.Str(), len(data), fi.Size)
+	}
+
+	return data, nil
+}
+
+// hasIntactCopy returns true if the blob is also stored in a pack which is not
+// contained in damaged.
+func hasIntactCopy(repo *Repository, h restic.BlobHandle, damaged restic.IDSet) bool {
+	list, found := repo.idx.Lookup(h.ID, h.Type)
+	if !found {
+		return false
+	}
+
+	for _, pb := range list {
+		if !damaged.Has(pb.PackID) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// decryptPackedBlob extracts the blob pb from the pack data, decrypts it and
+// checks that the plaintext matches the blob ID.
+func decryptPackedBlob(repo *Repository, data []byte, pb restic.PackedBlob) ([]byte, error) {
+	start, end := uint64(pb.Offset), uint64(pb.Offset)+uint64(pb.Length)
+	if end > uint64(len(data)) {
+		return nil, errors.Errorf("blob %v is truncated", pb.ID.Str())
+	}
+
+	buf := data[start:end]
+	if len(buf) < repo.Key().NonceSize() {
+		return nil, errors.Errorf("blob %v is too short", pb.ID.Str())
+	}
+
+	// decrypt into a new buffer, the pack data must not be modified
+	nonce, ciphertext := buf[:repo.Key().NonceSize()], buf[repo.Key().NonceSize():]
+	plaintext, err := repo.Key().Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("decrypting blob %v failed: %v", pb.ID.Str(), err)
+	}
+
+	if !restic.Hash(plaintext).Equal(pb.ID) {
+		return nil, errors.Errorf("blob %v has wrong content", pb.ID.Str())
+	}
+
+	return plaintext, nil
+}
+
+// replaceIndex saves a new index which contains all blobs known to repo except
+// those in the packs listed in removePacks, and removes all index files which
+// existed before.
+func replaceIndex(ctx context.Context, repo *Repository, removePacks restic.IDSet) error {
+	var supersedes restic.IDs
+	err := repo.List(ctx, restic.IndexFile, func(id restic.ID, size int64) error {
+		supersedes = append(supersedes, id)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	idx := NewIndex()
+	for pb := range repo.idx.Each(ctx) {
+		if removePacks.Has(pb.PackID) {
+			continue
+		}
+		idx.Store(pb)
+	}
+
+	// do not write an index with entries missing
+	if err := repo.idx.Err(); err != nil {
+		return err
+	}
+
+	err = idx.AddToSupersedes(supersedes...)
+	if err != nil {
+		return err
+	}
+
+	id, err := SaveIndex(ctx, repo, idx)
+	if err != nil {
+		return errors.Fatalf("unable to save index, last error was: %v", err)
+	}
+	debug.Log("saved new index as %v, superseding %d index files", id, len(supersedes))
+
+	for _, id := range supersedes {
+		h := restic.Handle{Type: restic.IndexFile, Name: id.String()}
+		if err := repo.Backend().Remove(ctx, h); err != nil {
+			return errors.Wrapf(err, "remove index %v", id.Str())
+		}
+	}
+
+	return nil
+}
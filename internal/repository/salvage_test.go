@@ -0,0 +1,169 @@
+package repository_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func loadPack(t testing.TB, repo restic.Repository, id restic.ID) []byte {
+	var buf []byte
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	err := repo.Backend().Load(context.TODO(), h, 0, 0, func(rd io.Reader) (err error) {
+		buf, err = ioutil.ReadAll(rd)
+		return err
+	})
+	rtest.OK(t, err)
+	return buf
+}
+
+func replacePack(t testing.TB, repo restic.Repository, id restic.ID, buf []byte) {
+	h := restic.Handle{Type: restic.DataFile, Name: id.String()}
+	rtest.OK(t, repo.Backend().Remove(context.TODO(), h))
+	rtest.OK(t, repo.Backend().Save(context.TODO(), h, restic.NewByteReader(buf)))
+}
+
+func TestSalvage(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	// save five blobs into one pack, the last one is also stored in a second
+	// pack
+	var blobs []restic.ID
+	for i := 0; i < 5; i++ {
+		buf := rtest.Random(i, 1000+i*100)
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, buf, restic.ID{})
+		rtest.OK(t, err)
+		blobs = append(blobs, id)
+	}
+	rtest.OK(t, repo.Flush(context.TODO()))
+
+	_, err := repo.SaveBlob(context.TODO(), restic.DataBlob, rtest.Random(4, 1400), restic.ID{})
+	rtest.OK(t, err)
+	rtest.OK(t, repo.Flush(context.TODO()))
+	saveIndex(t, repo)
+
+	list, _ := repo.Index().Lookup(blobs[0], restic.DataBlob)
+	damaged := list[0].PackID
+	entries := make(map[restic.ID]restic.PackedBlob)
+	for _, id := range blobs[:4] {
+		list, _ := repo.Index().Lookup(id, restic.DataBlob)
+		rtest.Equals(t, damaged, list[0].PackID)
+		entries[id] = list[0]
+	}
+
+	// modify the first blob and truncate the pack within the fourth blob
+	buf := loadPack(t, repo, damaged)
+	buf[entries[blobs[0]].Offset+20] ^= 0x01
+	buf = buf[:entries[blobs[3]].Offset+10]
+	replacePack(t, repo, damaged, buf)
+
+	stats, err := repository.Salvage(context.TODO(), repo.(*repository.Repository), restic.NewIDSet(damaged))
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 5, stats.Blobs)
+	rtest.Equals(t, 2, stats.Salvaged)
+	rtest.Equals(t, 1, stats.Duplicate)
+	rtest.Equals(t, restic.NewBlobSet(
+		restic.BlobHandle{ID: blobs[0], Type: restic.DataBlob},
+		restic.BlobHandle{ID: blobs[3], Type: restic.DataBlob},
+	), stats.Lost)
+
+	// the new index must not reference the damaged pack anymore
+	reloadIndex(t, repo)
+
+	var indexes int
+	rtest.OK(t, repo.List(context.TODO(), restic.IndexFile, func(restic.ID, int64) error {
+		indexes++
+		return nil
+	}))
+	rtest.Equals(t, 1, indexes)
+
+	for i, id := range blobs {
+		list, found := repo.Index().Lookup(id, restic.DataBlob)
+		if i == 0 || i == 3 {
+			rtest.Assert(t, !found, "lost blob %d is still contained in the index", i)
+			continue
+		}
+
+		rtest.Assert(t, found, "blob %d not found in the index", i)
+		for _, pb := range list {
+			rtest.Assert(t, !pb.PackID.Equal(damaged), "blob %d is still referenced in the damaged pack", i)
+		}
+
+		buf := restic.NewBlobBuffer(1000 + i*100)
+		n, err := repo.LoadBlob(context.TODO(), restic.DataBlob, id, buf)
+		rtest.OK(t, err)
+		rtest.Assert(t, bytes.Equal(rtest.Random(i, 1000+i*100), buf[:n]), "blob %d has wrong content", i)
+	}
+}
+
+// failLoadBackend returns an error when the pack failPack is loaded.
+type failLoadBackend struct {
+	restic.Backend
+	failPack restic.ID
+}
+
+func (be *failLoadBackend) Load(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+	if h.Type == restic.DataFile && h.Name == be.failPack.String() {
+		return errors.New("load failed")
+	}
+	return be.Backend.Load(ctx, h, length, offset, fn)
+}
+
+func TestSalvageLoadError(t *testing.T) {
+	be, cleanup := repository.TestBackend(t)
+	defer cleanup()
+
+	failBe := &failLoadBackend{Backend: be}
+	repo, cleanup := repository.TestRepositoryWithBackend(t, failBe)
+	defer cleanup()
+
+	var blobs []restic.ID
+	for i := 0; i < 3; i++ {
+		id, err := repo.SaveBlob(context.TODO(), restic.DataBlob, rtest.Random(i, 1000), restic.ID{})
+		rtest.OK(t, err)
+		blobs = append(blobs, id)
+	}
+	rtest.OK(t, repo.Flush(context.TODO()))
+	saveIndex(t, repo)
+
+	list, _ := repo.Index().Lookup(blobs[0], restic.DataBlob)
+	packID := list[0].PackID
+
+	var indexes restic.IDs
+	rtest.OK(t, repo.List(context.TODO(), restic.IndexFile, func(id restic.ID, size int64) error {
+		indexes = append(indexes, id)
+		return nil
+	}))
+
+	failBe.failPack = packID
+	_, err := repository.Salvage(context.TODO(), repo.(*repository.Repository), restic.NewIDSet(packID))
+	rtest.Assert(t, err != nil, "salvaging an unreadable pack did not fail")
+
+	// neither the pack nor the index must have been modified
+	ok, err := be.Test(context.TODO(), restic.Handle{Type: restic.DataFile, Name: packID.String()})
+	rtest.OK(t, err)
+	rtest.Assert(t, ok, "pack was removed")
+
+	var after restic.IDs
+	rtest.OK(t, repo.List(context.TODO(), restic.IndexFile, func(id restic.ID, size int64) error {
+		after = append(after, id)
+		return nil
+	}))
+	rtest.Equals(t, indexes, after)
+
+	reloadIndex(t, repo)
+	for _, id := range blobs {
+		list, found := repo.Index().Lookup(id, restic.DataBlob)
+		rtest.Assert(t, found, "blob %v was removed from the index", id.Str())
+		rtest.Equals(t, packID, list[0].PackID)
+	}
+}
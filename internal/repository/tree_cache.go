@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/options"
+	"github.com/restic/restic/internal/restic"
+)
+
+// defaultTreeCacheSize is the default capacity of the tree cache, measured in
+// bytes of the JSON encoded trees.
+const defaultTreeCacheSize = 32 * 1024 * 1024
+
+// TreeCacheOptions configures the cache for decoded trees.
+type TreeCacheOptions struct {
+	Size uint `option:"cache-size" help:"size of the cache for decoded trees in MiB, 0 disables the cache (default: 32)"`
+}
+
+func init() {
+	options.Register("trees", TreeCacheOptions{})
+}
+
+// NewTreeCacheOptions returns the default options for the tree cache.
+func NewTreeCacheOptions() TreeCacheOptions {
+	return TreeCacheOptions{Size: defaultTreeCacheSize >> 20}
+}
+
+// treeCache is a thread safe, size-bounded LRU cache of decoded trees. It is
+// used by LoadTree, so all users walking trees share it. The cache keeps its
+// own copy of the trees and returns a new copy for each call to Get, so
+// callers may modify the nodes of the trees they get.
+type treeCache struct {
+	m sync.Mutex
+
+	// capacity and current size, in bytes of the encoded trees
+	capacity int
+	size     int
+
+	// lru holds the entries, the most recently used one in front
+	lru     *list.List
+	entries map[restic.ID]*list.Element
+}
+
+type treeCacheEntry struct {
+	id   restic.ID
+	tree *restic.Tree
+	size int
+}
+
+// newTreeCache returns a new tree cache which holds trees with a total
+// encoded size of at most capacity bytes.
+func newTreeCache(capacity int) *treeCache {
+	return &treeCache{
+		capacity: capacity,
+		lru:      list.New(),
+		entries:  make(map[restic.ID]*list.Element),
+	}
+}
+
+// Get returns the tree with the given id, if it is in the cache.
+func (c *treeCache) Get(id restic.ID) (*restic.Tree, bool) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+
+	c.lru.MoveToFront(e)
+	return copyTree(e.Value.(*treeCacheEntry).tree), true
+}
+
+// Add inserts the tree with the given id and encoded size into the cache,
+// evicting the least recently used trees if necessary. Trees larger than the
+// capacity of the cache are not added.
+func (c *treeCache) Add(id restic.ID, tree *restic.Tree, size int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	if size > c.capacity {
+		debug.Log("tree %v is too large for the cache (%d bytes)", id.Str(), size)
+		return
+	}
+
+	if e, ok := c.entries[id]; ok {
+		c.lru.MoveToFront(e)
+		return
+	}
+
+	for c.size+size > c.capacity {
+		last := c.lru.Back()
+		entry := last.Value.(*treeCacheEntry)
+		c.lru.Remove(last)
+		delete(c.entries, entry.id)
+		c.size -= entry.size
+	}
+
+	c.entries[id] = c.lru.PushFront(&treeCacheEntry{id: id, tree: copyTree(tree), size: size})
+	c.size += size
+}
+
+// copyTree returns a copy of the tree and its nodes. The slices referenced by
+// the nodes, like the content of files, are shared with the original.
+func copyTree(tree *restic.Tree) *restic.Tree {
+	nodes := make([]*restic.Node, len(tree.Nodes))
+	for i, node := range tree.Nodes {
+		n := *node
+		nodes[i] = &n
+	}
+
+	return &restic.Tree{Nodes: nodes}
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"testing"
+
+	"github.com/restic/restic/internal/restic"
+)
+
+func TestTreeCache(t *testing.T) {
+	c := newTreeCache(100)
+
+	var ids restic.IDs
+	for i := 0; i < 4; i++ {
+		id := restic.NewRandomID()
+		ids = append(ids, id)
+		c.Add(id, restic.NewTree(), 30)
+	}
+
+	// the first tree must have been evicted
+	if _, ok := c.Get(ids[0]); ok {
+		t.Errorf("tree %v is still in the cache", ids[0].Str())
+	}
+
+	for _, id := range ids[1:] {
+		if _, ok := c.Get(id); !ok {
+			t.Errorf("tree %v not found in the cache", id.Str())
+		}
+	}
+
+	// use ids[1], so that ids[2] is the least recently used tree now
+	c.Get(ids[1])
+	id := restic.NewRandomID()
+	c.Add(id, restic.NewTree(), 30)
+
+	if _, ok := c.Get(ids[2]); ok {
+		t.Errorf("tree %v is still in the cache", ids[2].Str())
+	}
+
+	for _, id := range []restic.ID{ids[1], ids[3], id} {
+		if _, ok := c.Get(id); !ok {
+			t.Errorf("tree %v not found in the cache", id.Str())
+		}
+	}
+
+	if c.size != 90 {
+		t.Errorf("wrong cache size, want 90, got %d", c.size)
+	}
+
+	// trees larger than the cache are ignored
+	large := restic.NewRandomID()
+	c.Add(large, restic.NewTree(), 101)
+	if _, ok := c.Get(large); ok {
+		t.Errorf("tree %v larger than the cache has been added", large.Str())
+	}
+}
+
+func TestTreeCacheCopy(t *testing.T) {
+	c := newTreeCache(100)
+
+	id := restic.NewRandomID()
+	tree := restic.NewTree()
+	tree.Nodes = append(tree.Nodes, &restic.Node{Name: "foo", Size: 23})
+	c.Add(id, tree, 30)
+
+	// neither the added tree nor trees returned by Get are shared
+	tree.Nodes[0].Size = 42
+	got, ok := c.Get(id)
+	if !ok {
+		t.Fatalf("tree %v not found in the cache", id.Str())
+	}
+	if got.Nodes[0].Size != 23 {
+		t.Errorf("modification of the added tree changed the cache, size is %d", got.Nodes[0].Size)
+	}
+
+	got.Nodes[0].Path = "/foo"
+	got, _ = c.Get(id)
+	if got.Nodes[0].Path != "" {
+		t.Errorf("modification of a returned tree changed the cache, path is %q", got.Nodes[0].Path)
+	}
+}
+
+func TestTreeCacheDisabled(t *testing.T) {
+	c := newTreeCache(0)
+
+	id := restic.NewRandomID()
+	c.Add(id, restic.NewTree(), 30)
+	if _, ok := c.Get(id); ok {
+		t.Errorf("tree %v has been added to a disabled cache", id.Str())
+	}
+}
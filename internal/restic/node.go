@@ -172,9 +172,33 @@ func (node *Node) CreateAt(ctx context.Context, path string, repo Repository) er
 	return nil
 }
 
-// RestoreMetadata restores node metadata
+// MetadataError is returned when some metadata of a node, e.g. the owner or
+// the permissions, could not be restored. Op names the failed operation.
+type MetadataError struct {
+	Op   string
+	Path string
+	Err  error
+}
+
+func (e *MetadataError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+// RestoreMetadata restores the owner, the permissions, the timestamps and the
+// extended attributes of the node at path. If restoring any of them fails,
+// the first error is returned as a *MetadataError after trying the others.
 func (node Node) RestoreMetadata(path string) error {
-	err := node.restoreMetadata(path)
+	return node.restoreMetadataAt(path, true)
+}
+
+// RestoreMetadataNoOwner works like RestoreMetadata, but leaves the owner of
+// path unchanged.
+func (node Node) RestoreMetadataNoOwner(path string) error {
+	return node.restoreMetadataAt(path, false)
+}
+
+func (node Node) restoreMetadataAt(path string, owner bool) error {
+	err := node.restoreMetadata(path, owner)
 	if err != nil {
 		debug.Log("restoreMetadata(%s) error %v", path, err)
 	}
@@ -182,42 +206,51 @@ func (node Node) RestoreMetadata(path string) error {
 	return err
 }
 
-func (node Node) restoreMetadata(path string) error {
+func (node Node) restoreMetadata(path string, owner bool) error {
 	var firsterr error
 
-	if err := lchown(path, int(node.UID), int(node.GID)); err != nil {
-		// Like "cp -a" and "rsync -a" do, we only report lchown permission errors
-		// if we run as root.
-		// On Windows, Geteuid always returns -1, and we always report lchown
-		// permission errors.
-		if os.Geteuid() > 0 && os.IsPermission(err) {
-			debug.Log("not running as root, ignoring lchown permission error for %v: %v",
-				path, err)
-		} else {
-			firsterr = errors.Wrap(err, "Lchown")
+	fail := func(op string, err error) {
+		if firsterr != nil {
+			return
+		}
+
+		// the path is already part of the MetadataError
+		err = errors.Cause(err)
+		if pe, ok := err.(*os.PathError); ok {
+			err = pe.Err
+		}
+		firsterr = &MetadataError{Op: op, Path: path, Err: err}
+	}
+
+	if owner {
+		if err := lchown(path, int(node.UID), int(node.GID)); err != nil {
+			// Like "cp -a" and "rsync -a" do, we only report lchown permission errors
+			// if we run as root.
+			// On Windows, Geteuid always returns -1, and we always report lchown
+			// permission errors.
+			if os.Geteuid() > 0 && os.IsPermission(err) {
+				debug.Log("not running as root, ignoring lchown permission error for %v: %v",
+					path, err)
+			} else {
+				fail("lchown", err)
+			}
 		}
 	}
 
 	if node.Type != "symlink" {
 		if err := fs.Chmod(path, node.Mode); err != nil {
-			if firsterr != nil {
-				firsterr = errors.Wrap(err, "Chmod")
-			}
+			fail("chmod", err)
 		}
 	}
 
 	if err := node.RestoreTimestamps(path); err != nil {
 		debug.Log("error restoring timestamps for dir %v: %v", path, err)
-		if firsterr != nil {
-			firsterr = err
-		}
+		fail("utimes", err)
 	}
 
 	if err := node.restoreExtendedAttributes(path); err != nil {
 		debug.Log("error restoring extended attributes for %v: %v", path, err)
-		if firsterr != nil {
-			firsterr = err
-		}
+		fail("setxattr", err)
 	}
 
 	return firsterr
@@ -295,3 +295,26 @@ func TestFixTime(t *testing.T) {
 		})
 	}
 }
+
+func TestNodeRestoreMetadataError(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	node := restic.Node{
+		Name: "missing",
+		Type: "file",
+		Mode: 0644,
+	}
+	path := filepath.Join(tempdir, "missing")
+
+	err := node.RestoreMetadata(path)
+	merr, ok := err.(*restic.MetadataError)
+	rtest.Assert(t, ok, "expected *MetadataError, got %T: %v", err, err)
+	rtest.Equals(t, path, merr.Path)
+	rtest.Assert(t, os.IsNotExist(merr.Err), "unexpected error %v", merr.Err)
+
+	err = node.RestoreMetadataNoOwner(path)
+	merr, ok = err.(*restic.MetadataError)
+	rtest.Assert(t, ok, "expected *MetadataError, got %T: %v", err, err)
+	rtest.Equals(t, "chmod", merr.Op)
+}
@@ -12,20 +12,54 @@ import (
 
 // minTickerTime limits how often the progress ticker is updated. It can be
 // overridden using the RESTIC_PROGRESS_FPS (frames per second) environment
-// variable.
+// variable. Values below one are allowed, e.g. 0.0166 for one update per
+// minute.
 var minTickerTime = time.Second / 60
 
+// minProgressFPS and maxProgressFPS are the bounds for RESTIC_PROGRESS_FPS,
+// the lower bound is one update per day.
+const (
+	minProgressFPS = 1.0 / (24 * 60 * 60)
+	maxProgressFPS = 60
+)
+
+// customTickerTime is set when minTickerTime was configured by the user.
+var customTickerTime bool
+
 var isTerminal = terminal.IsTerminal(int(os.Stdout.Fd()))
 var forceUpdateProgress = make(chan bool)
 
 func init() {
-	fps, err := strconv.ParseInt(os.Getenv("RESTIC_PROGRESS_FPS"), 10, 64)
-	if err == nil && fps >= 1 {
-		if fps > 60 {
-			fps = 60
-		}
-		minTickerTime = time.Second / time.Duration(fps)
+	if d, ok := parseProgressFPS(os.Getenv("RESTIC_PROGRESS_FPS")); ok {
+		minTickerTime = d
+		customTickerTime = true
+	}
+}
+
+// parseProgressFPS returns the interval between two progress updates for the
+// frames per second in s, which is clamped to the supported range. If s is
+// not a positive number, ok is false.
+func parseProgressFPS(s string) (d time.Duration, ok bool) {
+	fps, err := strconv.ParseFloat(s, 64)
+	if err != nil || !(fps > 0) {
+		return 0, false
 	}
+
+	if fps > maxProgressFPS {
+		fps = maxProgressFPS
+	}
+	if fps < minProgressFPS {
+		fps = minProgressFPS
+	}
+
+	return time.Duration(float64(time.Second) / fps), true
+}
+
+// ProgressInterval returns the minimal interval between two progress updates
+// configured via the RESTIC_PROGRESS_FPS environment variable. If the
+// variable is not set or invalid, ok is false.
+func ProgressInterval() (d time.Duration, ok bool) {
+	return minTickerTime, customTickerTime
 }
 
 // Progress reports progress on an operation.
@@ -64,11 +98,14 @@ type ProgressFunc func(s Stat, runtime time.Duration, ticker bool)
 // function OnStart is executed once. Afterwards the function OnUpdate is
 // called when new data arrives or at least every d interval. The function
 // OnDone is called when Done() is called. Both functions are called
-// synchronously and can use shared state.
+// synchronously and can use shared state. When stdout is not a terminal,
+// OnUpdate is only called periodically if RESTIC_PROGRESS_FPS is set.
 func NewProgress() *Progress {
 	var d time.Duration
 	if isTerminal {
 		d = time.Second
+	} else if customTickerTime {
+		d = minTickerTime
 	}
 	return &Progress{d: d}
 }
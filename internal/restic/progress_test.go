@@ -0,0 +1,40 @@
+package restic
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseProgressFPS(t *testing.T) {
+	var tests = []struct {
+		s  string
+		d  time.Duration
+		ok bool
+	}{
+		{"", 0, false},
+		{"foo", 0, false},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"NaN", 0, false},
+		{"1", time.Second, true},
+		{"0.5", 2 * time.Second, true},
+		{"1000", time.Second / 60, true},
+		{"+Inf", time.Second / 60, true},
+		{"1e-12", 24 * time.Hour, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.s, func(t *testing.T) {
+			d, ok := parseProgressFPS(test.s)
+			if ok != test.ok {
+				t.Fatalf("wrong ok value for %q, want %v, got %v", test.s, test.ok, ok)
+			}
+
+			// allow for rounding errors of the float division
+			diff := d - test.d
+			if diff < -time.Microsecond || diff > time.Microsecond {
+				t.Errorf("wrong interval for %q, want %v, got %v", test.s, test.d, d)
+			}
+		})
+	}
+}
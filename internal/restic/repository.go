@@ -67,4 +67,10 @@ type Index interface {
 	// the context is cancelled, the background goroutine terminates. This
 	// blocks any modification of the index.
 	Each(ctx context.Context) <-chan PackedBlob
+
+	// Err returns the first error which occurred while reading entries of
+	// the index. Afterwards, the results of Has, Lookup and Each may be
+	// incomplete, so callers which depend on them being complete must check
+	// Err.
+	Err() error
 }
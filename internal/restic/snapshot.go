@@ -1,13 +1,17 @@
 package restic
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os/user"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/restic/restic/internal/debug"
+	"golang.org/x/sync/errgroup"
 )
 
 // Snapshot is the state of a resource at one point in time.
@@ -66,10 +70,69 @@ func LoadSnapshot(ctx context.Context, repo Repository, id ID) (*Snapshot, error
 	return sn, nil
 }
 
+// loadSnapshotParallelism is the number of snapshot files which are loaded
+// concurrently.
+const loadSnapshotParallelism = 8
+
+// ForAllSnapshots loads all snapshots in parallel and calls fn for each of
+// them as soon as it has been loaded, with the error encountered while loading
+// the snapshot (if any). The snapshots are passed to fn in no particular
+// order, callers which need a stable order must sort them. fn is never run
+// concurrently. If fn returns an error or ctx is cancelled, loading is stopped
+// and fn is not called again.
+func ForAllSnapshots(ctx context.Context, repo Repository, fn func(ID, *Snapshot, error) error) error {
+	var m sync.Mutex
+
+	// track spawned goroutines using wg, create a new context which is
+	// cancelled as soon as an error occurs.
+	wg, ctx := errgroup.WithContext(ctx)
+
+	ch := make(chan ID)
+
+	// send list of snapshot files through ch, which is closed afterwards
+	wg.Go(func() error {
+		defer close(ch)
+		return repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
+			select {
+			case <-ctx.Done():
+				return nil
+			case ch <- id:
+			}
+			return nil
+		})
+	})
+
+	// a worker receives a snapshot ID from ch, loads the snapshot and runs fn
+	worker := func() error {
+		for id := range ch {
+			debug.Log("load snapshot %v", id)
+			sn, err := LoadSnapshot(ctx, repo, id)
+
+			m.Lock()
+			// do not pass errors caused by the cancellation to fn
+			if ctx.Err() != nil {
+				m.Unlock()
+				return ctx.Err()
+			}
+			err = fn(id, sn, err)
+			m.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := 0; i < loadSnapshotParallelism; i++ {
+		wg.Go(worker)
+	}
+
+	return wg.Wait()
+}
+
 // LoadAllSnapshots returns a list of all snapshots in the repo.
 func LoadAllSnapshots(ctx context.Context, repo Repository) (snapshots []*Snapshot, err error) {
-	err = repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
-		sn, err := LoadSnapshot(ctx, repo, id)
+	err = ForAllSnapshots(ctx, repo, func(id ID, sn *Snapshot, err error) error {
 		if err != nil {
 			return err
 		}
@@ -82,9 +145,18 @@ func LoadAllSnapshots(ctx context.Context, repo Repository) (snapshots []*Snapsh
 		return nil, err
 	}
 
+	sortByID(snapshots)
 	return snapshots, nil
 }
 
+// sortByID sorts the snapshots by their ID, so that the order does not depend
+// on the order in which the snapshots were loaded.
+func sortByID(snapshots []*Snapshot) {
+	sort.Slice(snapshots, func(i, j int) bool {
+		return bytes.Compare(snapshots[i].id[:], snapshots[j].id[:]) < 0
+	})
+}
+
 func (sn Snapshot) String() string {
 	return fmt.Sprintf("<Snapshot %s of %v at %s by %s@%s>",
 		sn.id.Str(), sn.Paths, sn.Time, sn.Username, sn.Hostname)
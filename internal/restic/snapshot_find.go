@@ -33,8 +33,7 @@ func FindLatestSnapshot(ctx context.Context, repo Repository, targets []string,
 		found    bool
 	)
 
-	err = repo.List(ctx, SnapshotFile, func(snapshotID ID, size int64) error {
-		snapshot, err := LoadSnapshot(ctx, repo, snapshotID)
+	err = ForAllSnapshots(ctx, repo, func(snapshotID ID, snapshot *Snapshot, err error) error {
 		if err != nil {
 			return errors.Errorf("Error loading snapshot %v: %v", snapshotID.Str(), err)
 		}
@@ -85,8 +84,7 @@ func FindSnapshot(repo Repository, s string) (ID, error) {
 func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, tags []TagList, paths []string) (Snapshots, error) {
 	results := make(Snapshots, 0, 20)
 
-	err := repo.List(ctx, SnapshotFile, func(id ID, size int64) error {
-		sn, err := LoadSnapshot(ctx, repo, id)
+	err := ForAllSnapshots(ctx, repo, func(id ID, sn *Snapshot, err error) error {
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "could not load snapshot %v: %v\n", id.Str(), err)
 			return nil
@@ -104,5 +102,6 @@ func FindFilteredSnapshots(ctx context.Context, repo Repository, host string, ta
 		return nil, err
 	}
 
+	sortByID(results)
 	return results, nil
 }
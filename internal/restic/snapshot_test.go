@@ -1,9 +1,12 @@
 package restic_test
 
 import (
+	"context"
 	"testing"
 	"time"
 
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/repository"
 	"github.com/restic/restic/internal/restic"
 	rtest "github.com/restic/restic/internal/test"
 )
@@ -14,3 +17,43 @@ func TestNewSnapshot(t *testing.T) {
 	_, err := restic.NewSnapshot(paths, nil, "foo", time.Now())
 	rtest.OK(t, err)
 }
+
+func TestForAllSnapshots(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	want := restic.NewIDSet()
+	for i := 0; i < 20; i++ {
+		sn := restic.TestCreateSnapshot(t, repo, testSnapshotTime.Add(time.Duration(i)*time.Second), 0, 0)
+		want.Insert(*sn.ID())
+	}
+
+	got := restic.NewIDSet()
+	err := restic.ForAllSnapshots(context.TODO(), repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		rtest.OK(t, err)
+		rtest.Assert(t, id.Equal(*sn.ID()), "wrong snapshot for id %v: %v", id.Str(), sn)
+		got.Insert(id)
+		return nil
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, want, got)
+
+	// fn must not be called again after it returned an error
+	calls := 0
+	testErr := errors.New("test error")
+	err = restic.ForAllSnapshots(context.TODO(), repo, func(id restic.ID, sn *restic.Snapshot, err error) error {
+		calls++
+		return testErr
+	})
+	rtest.Equals(t, testErr, err)
+	rtest.Equals(t, 1, calls)
+
+	// the snapshots are returned in a stable order
+	snapshots, err := restic.LoadAllSnapshots(context.TODO(), repo)
+	rtest.OK(t, err)
+	rtest.Equals(t, len(want), len(snapshots))
+	for i := 1; i < len(snapshots); i++ {
+		rtest.Assert(t, snapshots[i-1].ID().String() < snapshots[i].ID().String(),
+			"snapshots are not sorted by ID")
+	}
+}
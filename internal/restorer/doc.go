@@ -24,6 +24,12 @@
 // required pack blobs. This may download blobs that are not needed, but we
 // assume it'll still be faster than getting individual blobs.
 //
+// The blobs needed by the files are decrypted while the pack is downloaded
+// and stored in the cache, each blob only once even if several files use it,
+// and are passed on to the files right away (step [3]). Blobs which are needed
+// by a file only after a blob stored later in the pack are held in memory
+// until the earlier blob has been written.
+//
 // Target files are written (step [3]) in the "right" order, first file blob
 // first, then second, then third and so on. Blob write order implies that some
 // pack blobs may not be immediately used, i.e. they are "out of order" for
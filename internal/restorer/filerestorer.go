@@ -3,6 +3,7 @@ package restorer
 import (
 	"context"
 	"io"
+	"io/ioutil"
 	"path/filepath"
 
 	"github.com/restic/restic/internal/crypto"
@@ -17,7 +18,6 @@ import (
 //      con: each worker needs to keep one pack in memory
 // TODO evaluate memory footprint for larger repositories, say 10M packs/10M files
 // TODO consider replacing pack file cache with blob cache
-// TODO avoid decrypting the same blob multiple times
 // TODO evaluate disabled debug logging overhead for large repositories
 
 const (
@@ -143,10 +143,8 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, onError func(path strin
 				if !ok {
 					return // channel closed
 				}
-				rd, err := r.downloadPack(ctx, request.pack)
-				if err == nil {
-					r.processPack(ctx, request, rd)
-				} else {
+				err := r.processPack(ctx, request)
+				if err != nil {
 					// mark all files as failed
 					for file := range request.files {
 						request.files[file] = err
@@ -223,14 +221,20 @@ func (r *fileRestorer) restoreFiles(ctx context.Context, onError func(path strin
 	return nil
 }
 
-func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) (readerAtCloser, error) {
+// processPack writes the blobs of the pack to the files of the request. If
+// the pack is not in the cache, the byte range of the pack required by all
+// files is downloaded with a single request, and the blobs for the files are
+// decrypted and written while the data is stored in the cache. Errors for
+// individual files are recorded in the request, the returned error means that
+// the pack could not be loaded at all.
+func (r *fileRestorer) processPack(ctx context.Context, request processingInfo) error {
 	const MaxInt64 = 1<<63 - 1 // odd Go does not have this predefined somewhere
 
 	// calculate pack byte range
 	start, end := int64(MaxInt64), int64(0)
-	for file := range pack.files {
+	for file := range request.pack.files {
 		r.idx.forEachFilePack(file, func(packIdx int, packID restic.ID, packBlobs []restic.Blob) bool {
-			if packID.Equal(pack.id) {
+			if packID.Equal(request.pack.id) {
 				for _, blob := range packBlobs {
 					if start > int64(blob.Offset) {
 						start = int64(blob.Offset)
@@ -245,8 +249,25 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) (reader
 		})
 	}
 
-	packReader, err := r.packCache.get(pack.id, start, int(end-start), func(offset int64, length int, wr io.WriteSeeker) error {
-		h := restic.Handle{Type: restic.DataFile, Name: pack.id.String()}
+	// the blobs to write now are at the head of the files
+	stream := newPackStream(r.key, request.pack.id, r.filesWriter.writeToFile)
+	for file := range request.files {
+		target := r.targetPath(file.location)
+		r.idx.forEachFilePack(file, func(packIdx int, packID restic.ID, packBlobs []restic.Blob) bool {
+			stream.addFile(file, target, packBlobs)
+			return false
+		})
+	}
+
+	onError := func(file *fileInfo, err error) {
+		request.files[file] = err
+	}
+
+	streamStart, streamEnd := stream.region()
+	streamed := false
+
+	packReader, err := r.packCache.get(request.pack.id, start, int(end-start), func(offset int64, length int, wr io.WriteSeeker) error {
+		h := restic.Handle{Type: restic.DataFile, Name: request.pack.id.String()}
 		return r.packLoader(ctx, h, length, offset, func(rd io.Reader) error {
 			// reset the file in case of a download retry
 			_, err := wr.Seek(0, io.SeekStart)
@@ -254,71 +275,47 @@ func (r *fileRestorer) downloadPack(ctx context.Context, pack *packInfo) (reader
 				return err
 			}
 
-			len, err := io.Copy(wr, rd)
+			// store everything in the cache and process the blobs on the way
+			tee := io.TeeReader(rd, wr)
+
+			var n int64
+			if streamEnd > streamStart {
+				_, err = io.CopyN(ioutil.Discard, tee, streamStart-offset)
+				if err != nil {
+					return err
+				}
+
+				n, err = stream.process(tee, streamStart, onError)
+				if err != nil {
+					return err
+				}
+				n += streamStart - offset
+			}
+
+			rest, err := io.Copy(ioutil.Discard, tee)
 			if err != nil {
 				return err
 			}
-			if len != int64(length) {
-				return errors.Errorf("unexpected pack size: expected %d but got %d", length, len)
+			if n+rest != int64(length) {
+				return errors.Errorf("unexpected pack size: expected %d but got %d", length, n+rest)
 			}
 
+			streamed = true
 			return nil
 		})
 	})
 	if err != nil {
-		return nil, err
-	}
-
-	return packReader, nil
-}
-
-func (r *fileRestorer) processPack(ctx context.Context, request processingInfo, rd readerAtCloser) {
-	defer rd.Close()
-
-	for file := range request.files {
-		target := r.targetPath(file.location)
-		r.idx.forEachFilePack(file, func(packIdx int, packID restic.ID, packBlobs []restic.Blob) bool {
-			for _, blob := range packBlobs {
-				debug.Log("Writing blob %s (%d bytes) from pack %s to %s", blob.ID.Str(), blob.Length, packID.Str(), file.location)
-				buf, err := r.loadBlob(rd, blob)
-				if err == nil {
-					err = r.filesWriter.writeToFile(target, buf)
-				}
-				if err != nil {
-					request.files[file] = err
-					break // could not restore the file
-				}
-			}
-			return false
-		})
-	}
-}
-
-func (r *fileRestorer) loadBlob(rd io.ReaderAt, blob restic.Blob) ([]byte, error) {
-	// TODO reconcile with Repository#loadBlob implementation
-
-	buf := make([]byte, blob.Length)
-
-	n, err := rd.ReadAt(buf, int64(blob.Offset))
-	if err != nil {
-		return nil, err
-	}
-
-	if n != int(blob.Length) {
-		return nil, errors.Errorf("error loading blob %v: wrong length returned, want %d, got %d", blob.ID.Str(), blob.Length, n)
-	}
-
-	// decrypt
-	nonce, ciphertext := buf[:r.key.NonceSize()], buf[r.key.NonceSize():]
-	plaintext, err := r.key.Open(ciphertext[:0], nonce, ciphertext, nil)
-	if err != nil {
-		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
+		return err
 	}
+	defer packReader.Close()
 
-	// check hash
-	if !restic.Hash(plaintext).Equal(blob.ID) {
-		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
+	if !streamed && streamEnd > streamStart {
+		// the pack was already in the cache
+		_, err = stream.process(io.NewSectionReader(packReader, streamStart, streamEnd-streamStart), streamStart, onError)
+		if err != nil {
+			return err
+		}
 	}
 
-	return plaintext, nil
+	return nil
 }
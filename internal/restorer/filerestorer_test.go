@@ -161,8 +161,10 @@ func newTestRepo(content []TestFile) *TestRepo {
 }
 
 func restoreAndVerify(t *testing.T, tempdir string, content []TestFile) {
-	repo := newTestRepo(content)
+	restoreAndVerifyRepo(t, tempdir, newTestRepo(content))
+}
 
+func restoreAndVerifyRepo(t *testing.T, tempdir string, repo *TestRepo) {
 	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.idx)
 	r.files = repo.files
 
@@ -211,3 +213,87 @@ func TestFileRestorerBasic(t *testing.T) {
 		},
 	})
 }
+
+func TestFileRestorerSharedBlobs(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	content := []TestFile{
+		TestFile{
+			name: "file1",
+			blobs: []TestBlob{
+				TestBlob{"data1", "pack1"},
+				TestBlob{"data2", "pack1"},
+				TestBlob{"data1", "pack1"},
+			},
+		},
+		TestFile{
+			name: "file2",
+			blobs: []TestBlob{
+				TestBlob{"data3", "pack1"},
+				TestBlob{"data2", "pack1"},
+				TestBlob{"data1", "pack1"},
+			},
+		},
+	}
+
+	repo := newTestRepo(content)
+
+	requests := 0
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		requests++
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	r := newFileRestorer(tempdir, repo.loader, repo.key, repo.idx)
+	r.files = repo.files
+
+	err := r.restoreFiles(context.TODO(), func(path string, err error) {
+		t.Errorf("unexpected error for %v: %v", path, err)
+	})
+	rtest.OK(t, err)
+
+	// all blobs are in the same pack, which must be loaded only once
+	rtest.Equals(t, 1, requests)
+
+	for _, file := range repo.files {
+		data, err := ioutil.ReadFile(r.targetPath(file.location))
+		rtest.OK(t, err)
+		rtest.Equals(t, repo.fileContent(file), string(data))
+	}
+}
+
+func TestFileRestorerRetry(t *testing.T) {
+	tempdir, cleanup := rtest.TempDir(t)
+	defer cleanup()
+
+	content := []TestFile{
+		TestFile{
+			name: "file1",
+			blobs: []TestBlob{
+				TestBlob{"data1-1", "pack1"},
+				TestBlob{"data1-2", "pack1"},
+				TestBlob{"data1-3", "pack1"},
+			},
+		},
+	}
+
+	repo := newTestRepo(content)
+
+	// the first attempt returns only half of the data, like an interrupted
+	// download, which is then retried
+	loader := repo.loader
+	repo.loader = func(ctx context.Context, h restic.Handle, length int, offset int64, fn func(rd io.Reader) error) error {
+		err := loader(ctx, h, length, offset, func(rd io.Reader) error {
+			return fn(io.LimitReader(rd, int64(length/2)))
+		})
+		if err == nil {
+			t.Fatal("truncated load did not return an error")
+		}
+
+		return loader(ctx, h, length, offset, fn)
+	}
+
+	restoreAndVerifyRepo(t, tempdir, repo)
+}
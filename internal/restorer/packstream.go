@@ -0,0 +1,215 @@
+package restorer
+
+import (
+	"io"
+	"io/ioutil"
+	"sort"
+
+	"github.com/restic/restic/internal/crypto"
+	"github.com/restic/restic/internal/debug"
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+)
+
+// packStream decrypts the blobs of a pack which are needed by a set of files
+// while reading the pack sequentially, and dispatches them to the files. Each
+// blob is decrypted only once, even if it is used by several files or several
+// times by the same file. Blobs which cannot be written yet because a file
+// still waits for a blob stored later in the pack are kept in memory until
+// they have been written to all files.
+type packStream struct {
+	key    *crypto.Key
+	packID restic.ID
+	write  func(target string, buf []byte) error
+
+	// needed blobs, sorted by offset
+	blobs []restic.Blob
+
+	// number of blobs which have been processed already, used to skip blobs
+	// when the pack is read again after a download retry
+	done int
+
+	// files still waiting for the blob with a given ID
+	waiting map[restic.ID][]*packStreamFile
+
+	// plaintext of blobs which are still needed, and the number of
+	// remaining uses
+	plaintext map[restic.ID][]byte
+	refs      map[restic.ID]int
+
+	// blobs which could not be decrypted
+	failed map[restic.ID]error
+}
+
+type packStreamFile struct {
+	file   *fileInfo
+	target string
+	blobs  []restic.Blob
+	next   int
+}
+
+// newPackStream prepares writing blobs from pack packID to files using write.
+func newPackStream(key *crypto.Key, packID restic.ID, write func(target string, buf []byte) error) *packStream {
+	return &packStream{
+		key:       key,
+		packID:    packID,
+		write:     write,
+		waiting:   make(map[restic.ID][]*packStreamFile),
+		plaintext: make(map[restic.ID][]byte),
+		refs:      make(map[restic.ID]int),
+		failed:    make(map[restic.ID]error),
+	}
+}
+
+// addFile registers that blobs, which are stored in this pack, must be written
+// to the file at target in this order.
+func (s *packStream) addFile(file *fileInfo, target string, blobs []restic.Blob) {
+	if len(blobs) == 0 {
+		return
+	}
+
+	f := &packStreamFile{file: file, target: target, blobs: blobs}
+	s.waiting[blobs[0].ID] = append(s.waiting[blobs[0].ID], f)
+
+	for _, blob := range blobs {
+		if s.refs[blob.ID] == 0 {
+			s.blobs = append(s.blobs, blob)
+		}
+		s.refs[blob.ID]++
+	}
+}
+
+// region returns the byte range of the pack which contains all needed blobs.
+func (s *packStream) region() (start, end int64) {
+	s.sortBlobs()
+
+	if len(s.blobs) == 0 {
+		return 0, 0
+	}
+
+	last := s.blobs[len(s.blobs)-1]
+	return int64(s.blobs[0].Offset), int64(last.Offset + last.Length)
+}
+
+func (s *packStream) sortBlobs() {
+	sort.Slice(s.blobs, func(i, j int) bool {
+		return s.blobs[i].Offset < s.blobs[j].Offset
+	})
+}
+
+// process reads the pack data from rd, which starts at offset in the pack,
+// up to the end of the last needed blob. Errors for individual blobs or files
+// are reported via onError, the returned error is only non-nil if reading
+// from rd failed. Returned is the number of bytes read from rd.
+func (s *packStream) process(rd io.Reader, offset int64, onError func(*fileInfo, error)) (int64, error) {
+	s.sortBlobs()
+
+	pos := offset
+	for i, blob := range s.blobs {
+		// skip data of blobs which are not needed
+		if int64(blob.Offset) > pos {
+			n, err := io.CopyN(ioutil.Discard, rd, int64(blob.Offset)-pos)
+			pos += n
+			if err != nil {
+				return pos - offset, errors.Wrap(err, "skip")
+			}
+		}
+
+		buf := make([]byte, blob.Length)
+		n, err := io.ReadFull(rd, buf)
+		pos += int64(n)
+		if err != nil {
+			return pos - offset, errors.Wrapf(err, "read blob %v", blob.ID.Str())
+		}
+
+		if i < s.done {
+			// already processed before the pack was read again
+			continue
+		}
+		s.done = i + 1
+
+		if s.refs[blob.ID] == 0 {
+			// all files which needed the blob have failed already
+			continue
+		}
+
+		plaintext, err := s.decrypt(blob, buf)
+		if err != nil {
+			s.failed[blob.ID] = err
+		} else {
+			s.plaintext[blob.ID] = plaintext
+		}
+
+		s.dispatch(blob.ID, onError)
+	}
+
+	return pos - offset, nil
+}
+
+func (s *packStream) decrypt(blob restic.Blob, buf []byte) ([]byte, error) {
+	nonce, ciphertext := buf[:s.key.NonceSize()], buf[s.key.NonceSize():]
+	plaintext, err := s.key.Open(ciphertext[:0], nonce, ciphertext, nil)
+	if err != nil {
+		return nil, errors.Errorf("decrypting blob %v failed: %v", blob.ID, err)
+	}
+
+	if !restic.Hash(plaintext).Equal(blob.ID) {
+		return nil, errors.Errorf("blob %v returned invalid hash", blob.ID)
+	}
+
+	return plaintext, nil
+}
+
+// dispatch writes the blob id to all files waiting for it. Afterwards, the
+// files write all subsequent blobs which are already available.
+func (s *packStream) dispatch(id restic.ID, onError func(*fileInfo, error)) {
+	files := s.waiting[id]
+	delete(s.waiting, id)
+
+	for _, f := range files {
+		for f.next < len(f.blobs) {
+			blob := f.blobs[f.next]
+
+			if err, ok := s.failed[blob.ID]; ok {
+				onError(f.file, err)
+				s.abandon(f)
+				break
+			}
+
+			buf, ok := s.plaintext[blob.ID]
+			if !ok {
+				// blob is stored later in the pack
+				s.waiting[blob.ID] = append(s.waiting[blob.ID], f)
+				break
+			}
+
+			debug.Log("Writing blob %s (%d bytes) from pack %s to %s", blob.ID.Str(), len(buf), s.packID.Str(), f.file.location)
+			err := s.write(f.target, buf)
+			if err != nil {
+				onError(f.file, err)
+				s.abandon(f)
+				break
+			}
+
+			f.next++
+			s.release(blob.ID)
+		}
+	}
+}
+
+// abandon releases all blobs which the file f still waits for, so that their
+// plaintext is not kept in memory after writing the file has failed.
+func (s *packStream) abandon(f *packStreamFile) {
+	for _, blob := range f.blobs[f.next:] {
+		s.release(blob.ID)
+	}
+	f.next = len(f.blobs)
+}
+
+// release drops the plaintext of the blob id once it is not needed any more.
+func (s *packStream) release(id restic.ID) {
+	s.refs[id]--
+	if s.refs[id] == 0 {
+		delete(s.plaintext, id)
+	}
+}
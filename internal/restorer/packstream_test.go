@@ -0,0 +1,158 @@
+package restorer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/restic/restic/internal/errors"
+	"github.com/restic/restic/internal/restic"
+	rtest "github.com/restic/restic/internal/test"
+)
+
+func TestPackStream(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		TestFile{
+			name: "file1",
+			blobs: []TestBlob{
+				TestBlob{"data1", "pack1"},
+				TestBlob{"data2", "pack1"},
+				TestBlob{"data3", "pack1"},
+			},
+		},
+		TestFile{
+			name: "file2",
+			blobs: []TestBlob{
+				TestBlob{"data3", "pack1"},
+				TestBlob{"data3", "pack1"},
+				TestBlob{"data1", "pack1"},
+			},
+		},
+	})
+
+	packID := repo.packID("pack1")
+	written := make(map[string][]byte)
+	stream := newPackStream(repo.key, packID, func(target string, buf []byte) error {
+		written[target] = append(written[target], buf...)
+		return nil
+	})
+
+	for _, file := range repo.files {
+		repo.idx.forEachFilePack(file, func(packIdx int, id restic.ID, packBlobs []restic.Blob) bool {
+			rtest.Equals(t, packID, id)
+			stream.addFile(file, file.location, packBlobs)
+			return false
+		})
+	}
+
+	// each blob is only decrypted once
+	rtest.Equals(t, 3, len(stream.blobs))
+
+	data := repo.packsIDToData[packID]
+	start, end := stream.region()
+	n, err := stream.process(bytes.NewReader(data[start:end]), start, func(file *fileInfo, err error) {
+		t.Errorf("unexpected error for %v: %v", file.location, err)
+	})
+	rtest.OK(t, err)
+	rtest.Equals(t, end-start, n)
+
+	for _, file := range repo.files {
+		rtest.Equals(t, repo.fileContent(file), string(written[file.location]))
+	}
+
+	// all plaintext must have been released
+	rtest.Equals(t, 0, len(stream.plaintext))
+	rtest.Equals(t, 0, len(stream.waiting))
+}
+
+func TestPackStreamCorruptBlob(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		TestFile{
+			name: "file1",
+			blobs: []TestBlob{
+				TestBlob{"data1", "pack1"},
+				TestBlob{"data2", "pack1"},
+			},
+		},
+		TestFile{
+			name: "file2",
+			blobs: []TestBlob{
+				TestBlob{"data1", "pack1"},
+			},
+		},
+	})
+
+	packID := repo.packID("pack1")
+	data := append([]byte{}, repo.packsIDToData[packID]...)
+
+	// damage the second blob, which is only used by file1
+	blob := repo.blobs[restic.Hash([]byte("data2"))][0]
+	data[blob.Offset+blob.Length-1] ^= 0xff
+
+	stream := newPackStream(repo.key, packID, func(target string, buf []byte) error {
+		return nil
+	})
+	for _, file := range repo.files {
+		repo.idx.forEachFilePack(file, func(packIdx int, id restic.ID, packBlobs []restic.Blob) bool {
+			stream.addFile(file, file.location, packBlobs)
+			return false
+		})
+	}
+
+	failed := make(map[string]error)
+	start, end := stream.region()
+	_, err := stream.process(bytes.NewReader(data[start:end]), start, func(file *fileInfo, err error) {
+		failed[file.location] = err
+	})
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 1, len(failed))
+	rtest.Assert(t, failed["file1"] != nil, "expected error for file1, got %v", failed)
+}
+
+func TestPackStreamWriteError(t *testing.T) {
+	repo := newTestRepo([]TestFile{
+		TestFile{
+			name: "file1",
+			blobs: []TestBlob{
+				TestBlob{"data1", "pack1"},
+				TestBlob{"data2", "pack1"},
+				TestBlob{"data3", "pack1"},
+			},
+		},
+		TestFile{
+			name: "file2",
+			blobs: []TestBlob{
+				TestBlob{"data3", "pack1"},
+			},
+		},
+	})
+
+	packID := repo.packID("pack1")
+	stream := newPackStream(repo.key, packID, func(target string, buf []byte) error {
+		if target == "file1" {
+			return errors.New("write failed")
+		}
+		return nil
+	})
+	for _, file := range repo.files {
+		repo.idx.forEachFilePack(file, func(packIdx int, id restic.ID, packBlobs []restic.Blob) bool {
+			stream.addFile(file, file.location, packBlobs)
+			return false
+		})
+	}
+
+	failed := make(map[string]error)
+	data := repo.packsIDToData[packID]
+	start, end := stream.region()
+	_, err := stream.process(bytes.NewReader(data[start:end]), start, func(file *fileInfo, err error) {
+		failed[file.location] = err
+	})
+	rtest.OK(t, err)
+
+	rtest.Equals(t, 1, len(failed))
+	rtest.Assert(t, failed["file1"] != nil, "expected error for file1, got %v", failed)
+
+	// the blobs of the failed file must not be kept in memory
+	rtest.Equals(t, 0, len(stream.plaintext))
+	rtest.Equals(t, 0, len(stream.waiting))
+}
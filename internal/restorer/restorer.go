@@ -20,6 +20,10 @@ type Restorer struct {
 
 	Error        func(location string, err error) error
 	SelectFilter func(item string, dstpath string, node *restic.Node) (selectedForRestore bool, childMayBeSelected bool)
+
+	// NoOwner disables restoring the owner and group of files and
+	// directories, they are owned by the user running the restore instead.
+	NoOwner bool
 }
 
 var restorerAbortOnAllErrors = func(location string, err error) error { return err }
@@ -156,7 +160,12 @@ func (res *Restorer) restoreNodeTo(ctx context.Context, node *restic.Node, targe
 
 func (res *Restorer) restoreNodeMetadataTo(node *restic.Node, target, location string) error {
 	debug.Log("restoreNodeMetadata %v %v %v", node.Name, target, location)
-	err := node.RestoreMetadata(target)
+	var err error
+	if res.NoOwner {
+		err = node.RestoreMetadataNoOwner(target)
+	} else {
+		err = node.RestoreMetadata(target)
+	}
 	if err != nil {
 		debug.Log("node.RestoreMetadata(%s) error %v", target, err)
 	}
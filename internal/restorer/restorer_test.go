@@ -27,6 +27,9 @@ type File struct {
 	Data  string
 	Links uint64
 	Inode uint64
+
+	// owner of the file, the current user is used if both are zero
+	UID, GID uint32
 }
 
 type Dir struct {
@@ -67,12 +70,16 @@ func saveDir(t testing.TB, repo restic.Repository, nodes map[string]Node, inode
 			if len(n.(File).Data) > 0 {
 				fc = append(fc, saveFile(t, repo, node))
 			}
+			uid, gid := node.UID, node.GID
+			if uid == 0 && gid == 0 {
+				uid, gid = uint32(os.Getuid()), uint32(os.Getgid())
+			}
 			tree.Insert(&restic.Node{
 				Type:    "file",
 				Mode:    0644,
 				Name:    name,
-				UID:     uint32(os.Getuid()),
-				GID:     uint32(os.Getgid()),
+				UID:     uid,
+				GID:     gid,
 				Content: fc,
 				Size:    uint64(len(n.(File).Data)),
 				Inode:   fi,
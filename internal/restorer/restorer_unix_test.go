@@ -59,3 +59,41 @@ func TestRestorerRestoreEmptyHardlinkedFileds(t *testing.T) {
 		rtest.Equals(t, s1.Ino, s2.Ino)
 	}
 }
+
+func TestRestorerNoOwner(t *testing.T) {
+	repo, cleanup := repository.TestRepository(t)
+	defer cleanup()
+
+	_, id := saveSnapshot(t, repo, Snapshot{
+		Nodes: map[string]Node{
+			"file": File{Data: "content: file\n", UID: 4321, GID: 4321},
+		},
+	})
+
+	for _, noOwner := range []bool{false, true} {
+		res, err := NewRestorer(repo, id)
+		rtest.OK(t, err)
+		res.NoOwner = noOwner
+
+		tempdir, cleanup := rtest.TempDir(t)
+		defer cleanup()
+
+		err = res.RestoreTo(context.TODO(), tempdir)
+		rtest.OK(t, err)
+
+		fi, err := os.Lstat(filepath.Join(tempdir, "file"))
+		rtest.OK(t, err)
+		stat, ok := fi.Sys().(*syscall.Stat_t)
+		if !ok {
+			t.Skip("unable to get owner of restored file")
+		}
+
+		// the owner can only be changed when running as root
+		wantUID := uint32(os.Getuid())
+		if !noOwner && os.Geteuid() == 0 {
+			wantUID = 4321
+		}
+		rtest.Equals(t, wantUID, stat.Uid)
+		rtest.Equals(t, os.FileMode(0644), fi.Mode())
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 )
 
 // Terminal is used to write messages and display status lines which can be
@@ -22,6 +23,10 @@ type Terminal struct {
 	status          chan status
 	canUpdateStatus bool
 
+	// statusInterval is the interval at which the first status line is
+	// printed as a plain line when the status cannot be updated in place
+	statusInterval time.Duration
+
 	// will be closed when the goroutine which runs Run() terminates, so it'll
 	// yield a default value immediately
 	closed chan struct{}
@@ -75,6 +80,19 @@ func New(wr io.Writer, errWriter io.Writer, disableStatus bool) *Terminal {
 	return t
 }
 
+// SetStatusInterval configures the terminal to print the first status line
+// every d when the status lines cannot be updated in place, e.g. when the
+// output is redirected to a log file. A zero duration (the default) disables
+// the periodic output. It must be called before Run.
+func (t *Terminal) SetStatusInterval(d time.Duration) {
+	t.statusInterval = d
+}
+
+// StatusInterval returns the interval configured with SetStatusInterval.
+func (t *Terminal) StatusInterval() time.Duration {
+	return t.statusInterval
+}
+
 // Run updates the screen. It should be run in a separate goroutine. When
 // ctx is cancelled, the status lines are cleanly removed.
 func (t *Terminal) Run(ctx context.Context) {
@@ -185,12 +203,41 @@ func (t *Terminal) writeStatus(status []string) {
 }
 
 // runWithoutStatus listens on the channels and just prints out the messages,
-// without status lines.
+// without status lines. If a status interval is configured, the first status
+// line is printed periodically.
 func (t *Terminal) runWithoutStatus(ctx context.Context) {
+	var (
+		ticker     <-chan time.Time
+		lastStatus string
+		printed    bool
+	)
+
+	if t.statusInterval > 0 {
+		tick := time.NewTicker(t.statusInterval)
+		defer tick.Stop()
+		ticker = tick.C
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-ticker:
+			if printed || lastStatus == "" {
+				continue
+			}
+
+			_, err := t.wr.WriteString(lastStatus + "\n")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "write failed: %v\n", err)
+				continue
+			}
+
+			err = t.wr.Flush()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "flush failed: %v\n", err)
+			}
+			printed = true
 		case msg := <-t.msg:
 			var err error
 			var flush func() error
@@ -222,8 +269,21 @@ func (t *Terminal) runWithoutStatus(ctx context.Context) {
 				fmt.Fprintf(os.Stderr, "flush failed: %v\n", err)
 			}
 
-		case _ = <-t.status:
-			// discard status lines
+		case stat := <-t.status:
+			if ticker == nil {
+				// discard status lines
+				continue
+			}
+
+			// remember the first line for the next periodic output
+			line := ""
+			if len(stat.lines) > 0 {
+				line = strings.TrimRight(stat.lines[0], "\n")
+			}
+			if line != lastStatus {
+				lastStatus = line
+				printed = false
+			}
 		}
 	}
 }
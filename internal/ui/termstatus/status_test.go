@@ -1,6 +1,12 @@
 package termstatus
 
-import "testing"
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+)
 
 func TestTruncate(t *testing.T) {
 	var tests = []struct {
@@ -30,3 +36,26 @@ func TestTruncate(t *testing.T) {
 		})
 	}
 }
+
+func TestStatusInterval(t *testing.T) {
+	buf := bytes.NewBuffer(nil)
+	term := New(buf, ioutil.Discard, false)
+	term.SetStatusInterval(10 * time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		term.Run(ctx)
+		close(done)
+	}()
+
+	term.SetStatus([]string{"status line", "file"})
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	want := "status line\n"
+	if buf.String() != want {
+		t.Fatalf("wrong output, want %q, got %q", want, buf.String())
+	}
+}
@@ -67,11 +67,15 @@ func walk(ctx context.Context, repo TreeLoader, prefix string, parentTreeID rest
 		allNodesIgnored = false
 	}
 
-	sort.Slice(tree.Nodes, func(i, j int) bool {
-		return tree.Nodes[i].Name < tree.Nodes[j].Name
+	// sort a copy of the list of nodes, the tree may be shared with other
+	// users of the repository
+	nodes := make([]*restic.Node, len(tree.Nodes))
+	copy(nodes, tree.Nodes)
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].Name < nodes[j].Name
 	})
 
-	for _, node := range tree.Nodes {
+	for _, node := range nodes {
 		p := path.Join(prefix, node.Name)
 
 		if node.Type == "" {